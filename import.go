@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"kmem/internal/cache"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/geo"
+	"kmem/internal/importer"
+	"kmem/internal/models"
+	"kmem/internal/queue"
+	"os"
+)
+
+func runImport(args []string, pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, geocoder *geo.Geocoder) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	username := fs.String("user", "", "owner of the imported files")
+	fs.Parse(args)
+
+	if len(*username) == 0 || fs.NArg() != 1 {
+		return fmt.Errorf("usage: kmem import -user <username> <directory|archive>")
+	}
+
+	im := importer.New(pg, conf, func(file models.File) {
+		q.Add(queue.GenThumbnail(pg, conf, nil, file))
+		q.Add(queue.ExtractMetadata(pg, cache, geocoder, file))
+		if file.IsVideo() {
+			q.Add(queue.TranscodeVideo(pg, conf, cache, nil, file))
+		}
+	})
+
+	summary, err := im.Run(*username, fs.Arg(0), func(done, total int) {
+		fmt.Printf("\rimporting %d/%d", done, total)
+	})
+	fmt.Println()
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("waiting for thumbnails...")
+	q.Wait()
+
+	out, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, string(out))
+
+	return nil
+}
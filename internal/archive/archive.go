@@ -0,0 +1,189 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// streams entries straight into the underlying writer - nothing is
+// buffered on disk
+type Writer interface {
+	// copies the file at src into the archive as name
+	AddFile(name, src string, modified time.Time) error
+	AddBytes(name string, data []byte, modified time.Time) error
+	Close() error
+}
+
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "zip":
+		return NewZip(w), nil
+	case "tar":
+		return NewTar(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func NewZip(w io.Writer) Writer {
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+func (w *zipWriter) AddFile(name, src string, modified time.Time) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", src, err)
+	}
+	defer f.Close()
+
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store, // photos & videos are compressed already
+		Modified: modified,
+	}
+
+	dst, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry %s: %v", name, err)
+	}
+
+	if _, err := io.Copy(dst, f); err != nil {
+		return fmt.Errorf("failed to write zip entry %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func (w *zipWriter) AddBytes(name string, data []byte, modified time.Time) error {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	}
+
+	dst, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry %s: %v", name, err)
+	}
+
+	if _, err := dst.Write(data); err != nil {
+		return fmt.Errorf("failed to write zip entry %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+type tarWriter struct {
+	tw *tar.Writer
+}
+
+func NewTar(w io.Writer) Writer {
+	return &tarWriter{tw: tar.NewWriter(w)}
+}
+
+func (w *tarWriter) AddFile(name, src string, modified time.Time) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", src, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", src, err)
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: modified,
+		Format:  tar.FormatPAX, // utf-8 names
+	}
+
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to create tar entry %s: %v", name, err)
+	}
+
+	if _, err := io.Copy(w.tw, f); err != nil {
+		return fmt.Errorf("failed to write tar entry %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func (w *tarWriter) AddBytes(name string, data []byte, modified time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modified,
+		Format:  tar.FormatPAX,
+	}
+
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to create tar entry %s: %v", name, err)
+	}
+
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write tar entry %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func (w *tarWriter) Close() error {
+	return w.tw.Close()
+}
+
+// hands out unique entry names, "a.jpg" then "a (1).jpg", "a (2).jpg" ...
+type Namer struct {
+	used map[string]bool
+}
+
+func NewNamer() *Namer {
+	return &Namer{used: make(map[string]bool)}
+}
+
+func (n *Namer) Unique(name string) string {
+	name = sanitize(name)
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; n.used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+
+	// case insensitive so archives extract cleanly on windows & macos
+	n.used[strings.ToLower(candidate)] = true
+
+	return candidate
+}
+
+// original names are user input - keep them from escaping the archive root
+func sanitize(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	name = strings.TrimLeft(name, ".")
+
+	if len(name) == 0 {
+		return "file"
+	}
+
+	return name
+}
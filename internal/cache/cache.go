@@ -49,12 +49,17 @@ func (c *Cache) run() {
 }
 
 func (c *Cache) Set(key string, val any) {
+	c.SetFor(key, val, c.ttl)
+}
+
+// for values built ahead of time that should outlive the default ttl
+func (c *Cache) SetFor(key string, val any, ttl time.Duration) {
 	c.list.Store(key,
 		cacheItem{
 			key:     key,
 			val:     val,
 			hit:     0,
-			expires: time.Now().Add(c.ttl).Unix(),
+			expires: time.Now().Add(ttl).Unix(),
 		})
 }
 
@@ -79,10 +84,12 @@ func (c *Cache) Get(key string) (any, bool) {
 func (c *Cache) InvalidateUserGallery(username string) {
 	galleryPrefix := fmt.Sprintf("gallery:%s", username)
 	statsPrefix := fmt.Sprintf("%s:stats", username)
+	memoriesPrefix := fmt.Sprintf("memories:%s:", username)
 
 	c.list.Range(func(key, value any) bool {
 		keyStr := key.(string)
-		if strings.HasPrefix(keyStr, galleryPrefix) || strings.HasPrefix(keyStr, statsPrefix) {
+		if strings.HasPrefix(keyStr, galleryPrefix) || strings.HasPrefix(keyStr, statsPrefix) ||
+			strings.HasPrefix(keyStr, memoriesPrefix) {
 			c.list.Delete(key)
 		}
 		return true
@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -20,10 +23,38 @@ type ServerConfig struct {
 	Port       int    `yaml:"port"`
 	JwtSecret  string `yaml:"jwtSecret"`
 	UploadPath string `yaml:"uploadPath"`
+	ExportPath string `yaml:"exportPath"` // archives built by jobs, kept out of /static
+	// zip downloads bigger than this are built by a background job (bytes)
+	ZipStreamLimit int64 `yaml:"zipStreamLimit"`
+	// server side directory admins can import from, import endpoint is off when empty
+	ImportPath string   `yaml:"importPath"`
+	Admins     []string `yaml:"admins"`
+	// per user storage in bytes, users get a warning event close to it, 0 for none
+	Quota int64 `yaml:"quota"`
+	// "WxH" sizes /img may render, anything else is rejected
+	ImageSizes     []string `yaml:"imageSizes"`
+	ImageCachePath string   `yaml:"imageCachePath"` // rendered /img variants, kept out of /static
+	ImageCacheSize int64    `yaml:"imageCacheSize"` // bytes
+	// encoded by ffmpeg next to the jpeg thumbnails (webp, avif) and offered by /img
+	ImageFormats []string `yaml:"imageFormats"`
+	// directory of a geonames dump (cities*.txt, admin1CodesASCII.txt, countryInfo.txt)
+	// for offline reverse geocoding, places are not looked up when empty
+	GeoNamesPath string `yaml:"geoNamesPath"`
+	// extensions uploads are refused for, any other type is stored as a general file
+	BlockedExtensions []string `yaml:"blockedExtensions"`
 	// AccessTokenDur   int    `yaml:"accessTokenDur"`  // in min
 	// RefreeshTokenDur int    `yaml:"refreshTokenDur"` // in min
 }
 
+var defaultImageSizes = []string{"150x150", "300x300", "800x600", "1600x1200"}
+
+// executables and scripts a desktop might run when opened, and active
+// content a browser would run on the kmem origin
+var defaultBlockedExtensions = []string{
+	".exe", ".msi", ".bat", ".cmd", ".com", ".scr", ".pif", ".ps1", ".vbs", ".jar", ".apk", ".dll",
+	".html", ".htm", ".xhtml", ".shtml", ".svg", ".svgz", ".js", ".mjs", ".xml", ".xsl",
+}
+
 type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Postgres PostgresConfig `yaml:"postgres"`
@@ -31,8 +62,16 @@ type Config struct {
 
 func prepare(configPath string) error {
 	sc := ServerConfig{
-		Port:       8000,
-		UploadPath: "/home/kang/Downloads/uploads",
+		Port:           8000,
+		UploadPath:     "/home/kang/Downloads/uploads",
+		ExportPath:     "/home/kang/Downloads/exports",
+		ZipStreamLimit: 2 << 30,
+		Admins:         []string{},
+		ImageSizes:     defaultImageSizes,
+		ImageCacheSize: 1 << 30,
+		ImageFormats:   []string{"webp"},
+
+		BlockedExtensions: defaultBlockedExtensions,
 	}
 
 	pg := PostgresConfig{Host: "localhost",
@@ -118,3 +157,85 @@ func (c *Config) JwtSecretKey() string {
 func (c *Config) UploadPath() string {
 	return c.Server.UploadPath
 }
+
+// falls back to a sibling of the upload path so archives never end up
+// under the public /static mount
+func (c *Config) ExportPath() string {
+	if len(c.Server.ExportPath) == 0 {
+		return filepath.Join(filepath.Dir(c.Server.UploadPath), "exports")
+	}
+
+	return c.Server.ExportPath
+}
+
+func (c *Config) ZipStreamLimit() int64 {
+	if c.Server.ZipStreamLimit <= 0 {
+		return 2 << 30 // 2GB
+	}
+
+	return c.Server.ZipStreamLimit
+}
+
+func (c *Config) ImportPath() string {
+	return c.Server.ImportPath
+}
+
+func (c *Config) IsAdmin(username string) bool {
+	return slices.Contains(c.Server.Admins, username)
+}
+
+func (c *Config) Quota() int64 {
+	return c.Server.Quota
+}
+
+func (c *Config) ImageSizeAllowed(width, height int) bool {
+	sizes := c.Server.ImageSizes
+	if len(sizes) == 0 {
+		sizes = defaultImageSizes
+	}
+
+	return slices.Contains(sizes, fmt.Sprintf("%dx%d", width, height))
+}
+
+func (c *Config) ImageCachePath() string {
+	if len(c.Server.ImageCachePath) == 0 {
+		return filepath.Join(filepath.Dir(c.Server.UploadPath), "cache", "img")
+	}
+
+	return c.Server.ImageCachePath
+}
+
+func (c *Config) ImageCacheSize() int64 {
+	if c.Server.ImageCacheSize <= 0 {
+		return 1 << 30 // 1GB
+	}
+
+	return c.Server.ImageCacheSize
+}
+
+// nil means jpeg only
+func (c *Config) ImageFormats() []string {
+	return c.Server.ImageFormats
+}
+
+func (c *Config) GeoNamesPath() string {
+	return c.Server.GeoNamesPath
+}
+
+// lower case with the leading dot, defaults when unset, an empty list blocks nothing
+func (c *Config) BlockedExtensions() []string {
+	if c.Server.BlockedExtensions == nil {
+		return defaultBlockedExtensions
+	}
+
+	exts := make([]string, 0, len(c.Server.BlockedExtensions))
+	for _, ext := range c.Server.BlockedExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if len(ext) > 0 && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+
+	return exts
+}
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+	"strconv"
+)
+
+func (pg *Postgres) InsertAlbum(album models.Album) (int, error) {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	query, err := albumQuery(album.Query)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRowContext(txctx, `
+		INSERT INTO albums(username,name,query) VALUES($1,$2,$3) RETURNING id
+	`, album.Username, album.Name, query).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert album: %v", err)
+	}
+
+	if err := recordChange(txctx, tx, models.Change{Username: album.Username, Kind: models.ChangeAlbumCreate, AlbumID: id}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return id, nil
+}
+
+// the saved filter as stored, NULL for manual albums
+func albumQuery(filter *models.FileFilter) (any, error) {
+	if filter == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal album query: %v", err)
+	}
+
+	return string(b), nil
+}
+
+func scanAlbumQuery(raw sql.NullString) *models.FileFilter {
+	if !raw.Valid {
+		return nil
+	}
+
+	var filter models.FileFilter
+	if err := json.Unmarshal([]byte(raw.String), &filter); err != nil {
+		log.Printf("invalid album query: %v", err)
+	}
+
+	return &filter
+}
+
+// for importers, manual albums are matched by name
+func (pg *Postgres) GetOrCreateAlbum(username, name string) (int, error) {
+	var id int
+	err := pg.conn.QueryRow(`
+		SELECT id FROM albums WHERE username=$1 AND name=$2 AND query IS NULL ORDER BY id LIMIT 1
+	`, username, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+
+	return pg.InsertAlbum(models.Album{Username: username, Name: name})
+}
+
+func (pg *Postgres) GetAlbums(username string) ([]models.Album, error) {
+	rows, err := pg.conn.Query(`
+		SELECT a.id,a.username,a.name,a.created_at,COUNT(f.id),a.query,COALESCE(m.role,'owner')
+		FROM albums AS a
+		LEFT JOIN album_members AS m ON m.album_id=a.id AND m.username=$1
+		LEFT JOIN album_files AS af ON a.id=af.album_id
+		LEFT JOIN files AS f ON af.file_id=f.id AND f.deleted=false
+		WHERE a.username=$1 OR m.username IS NOT NULL
+		GROUP BY a.id,m.role
+		ORDER BY a.created_at DESC
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get albums for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	albums := []models.Album{}
+	for rows.Next() {
+		var album models.Album
+		var query sql.NullString
+		if err := rows.Scan(&album.ID, &album.Username, &album.Name, &album.CreatedAt, &album.FileCount, &query, &album.Role); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		album.Query = scanAlbumQuery(query)
+		albums = append(albums, album)
+	}
+	rows.Close()
+
+	// smart albums are counted over the files of their owner
+	for i := range albums {
+		if !albums[i].IsSmart() {
+			continue
+		}
+
+		count, err := pg.GetFilesCount(albums[i].Username, *albums[i].Query, true)
+		if err != nil {
+			return nil, err
+		}
+		albums[i].FileCount = count
+	}
+
+	return albums, nil
+}
+
+// an album the user owns or is a member of
+func (pg *Postgres) GetAlbum(username, albumId string) (models.Album, error) {
+	var album models.Album
+	var query sql.NullString
+
+	err := pg.conn.QueryRow(`
+		SELECT a.id,a.username,a.name,a.created_at,a.query,COALESCE(m.role,'owner')
+		FROM albums AS a
+		LEFT JOIN album_members AS m ON m.album_id=a.id AND m.username=$2
+		WHERE a.id=$1 AND (a.username=$2 OR m.username IS NOT NULL)
+	`, albumId, username).Scan(&album.ID, &album.Username, &album.Name, &album.CreatedAt, &query, &album.Role)
+	if err != nil {
+		return album, fmt.Errorf("failed to get album %s: %v", albumId, err)
+	}
+
+	album.Query = scanAlbumQuery(query)
+
+	return album, nil
+}
+
+// only smart albums have a query, manual ones stay manual
+func (pg *Postgres) SetAlbumQuery(username, albumId string, filter models.FileFilter) error {
+	id, err := strconv.Atoi(albumId)
+	if err != nil {
+		return fmt.Errorf("invalid album id: %s", albumId)
+	}
+
+	query, err := albumQuery(&filter)
+	if err != nil {
+		return err
+	}
+
+	return pg.execChange(models.Change{Username: username, Kind: models.ChangeAlbumUpdate, AlbumID: id},
+		`UPDATE albums SET query=$1 WHERE username=$2 AND id=$3 AND query IS NOT NULL`, query, username, id)
+}
+
+func (pg *Postgres) RenameAlbum(username, albumId, newName string) error {
+	id, err := strconv.Atoi(albumId)
+	if err != nil {
+		return fmt.Errorf("invalid album id: %s", albumId)
+	}
+
+	return pg.execChange(models.Change{Username: username, Kind: models.ChangeAlbumUpdate, AlbumID: id},
+		`UPDATE albums SET name=$1 WHERE username=$2 AND id=$3`, newName, username, id)
+}
+
+// files stay, only the album and its memberships are removed
+func (pg *Postgres) DeleteAlbum(username, albumId string) error {
+	id, err := strconv.Atoi(albumId)
+	if err != nil {
+		return fmt.Errorf("invalid album id: %s", albumId)
+	}
+
+	return pg.execChange(models.Change{Username: username, Kind: models.ChangeAlbumDelete, AlbumID: id},
+		`DELETE FROM albums WHERE username=$1 AND id=$2`, username, id)
+}
+
+func (pg *Postgres) AddAlbumFiles(username, albumId string, fileIds []int) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	// the owner, contributors and editors add files
+	var id int
+	var smart bool
+	err = tx.QueryRowContext(txctx, `
+		SELECT a.id,a.query IS NOT NULL FROM albums AS a
+		LEFT JOIN album_members AS m ON m.album_id=a.id AND m.username=$2
+		WHERE a.id=$1 AND (a.username=$2 OR m.role IN ($3,$4))
+	`, albumId, username, models.RoleContributor, models.RoleEditor).Scan(&id, &smart)
+	if err != nil {
+		return fmt.Errorf("album not found: %s", albumId)
+	}
+	if smart {
+		return fmt.Errorf("files can't be added to smart album %s", albumId)
+	}
+
+	for _, fileId := range fileIds {
+		// only the user's own files can be added
+		result, err := tx.ExecContext(txctx, `
+			INSERT INTO album_files(album_id,file_id)
+			SELECT $1,id FROM files WHERE id=$2 AND username=$3
+			ON CONFLICT DO NOTHING
+		`, id, fileId, username)
+		if err != nil {
+			return fmt.Errorf("failed to add file %d to album %s: %v", fileId, albumId, err)
+		}
+
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			c := models.Change{Username: username, Kind: models.ChangeAlbumAdd, FileID: fileId, AlbumID: id}
+			if err := recordChange(txctx, tx, c); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+func (pg *Postgres) RemoveAlbumFile(username, albumId, fileId string) error {
+	aid, err := strconv.Atoi(albumId)
+	if err != nil {
+		return fmt.Errorf("invalid album id: %s", albumId)
+	}
+
+	fid, err := strconv.Atoi(fileId)
+	if err != nil {
+		return fmt.Errorf("invalid file id: %s", fileId)
+	}
+
+	// the owner and editors remove any file, everyone their own ones
+	return pg.execChange(models.Change{Username: username, Kind: models.ChangeAlbumRemove, FileID: fid, AlbumID: aid}, `
+		DELETE FROM album_files
+		WHERE album_id=$1 AND file_id=$3 AND (
+			EXISTS (SELECT 1 FROM albums WHERE id=$1 AND username=$2)
+			OR EXISTS (SELECT 1 FROM album_members WHERE album_id=$1 AND username=$2 AND role=$4)
+			OR EXISTS (SELECT 1 FROM files WHERE id=$3 AND username=$2)
+		)
+	`, aid, username, fid, models.RoleEditor)
+}
+
+func (pg *Postgres) GetAlbumFilesPage(username, albumId string, page, limit int) ([]models.FileResponse, error) {
+	rows, err := pg.conn.Query(`
+		SELECT f.id,f.original_name,f.relative_path,f.mime_type,f.username,t.size_name,t.relative_path,t.width,t.height,t.format FROM (
+			SELECT f.id,f.original_name,f.relative_path,f.mime_type,f.username,COALESCE(f.taken_at,f.uploaded_at) AS captured
+			FROM files AS f
+			JOIN album_files AS af ON f.id=af.file_id
+			JOIN albums AS a ON a.id=af.album_id
+			WHERE a.id=$1 AND f.deleted=false
+			AND (a.username=$2 OR EXISTS (SELECT 1 FROM album_members WHERE album_id=a.id AND username=$2))
+			ORDER BY captured DESC
+			LIMIT $3 OFFSET $4
+		) AS f
+		LEFT JOIN thumbnails AS t ON f.id=t.file_id
+		ORDER BY f.captured DESC
+	`, albumId, username, limit, page*limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get album files for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	return pg.withRenditions(scanFileResponses(rows))
+}
+
+// album id -> file ids
+func (pg *Postgres) GetAlbumFilesMap(username string) (map[int][]int, error) {
+	rows, err := pg.conn.Query(`
+		SELECT af.album_id,af.file_id FROM album_files AS af
+		JOIN albums AS a ON a.id=af.album_id
+		WHERE a.username=$1
+		ORDER BY af.added_at ASC
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get album files for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	amap := make(map[int][]int)
+	for rows.Next() {
+		var albumId, fileId int
+		if err := rows.Scan(&albumId, &fileId); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		amap[albumId] = append(amap[albumId], fileId)
+	}
+
+	return amap, nil
+}
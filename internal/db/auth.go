@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"kmem/internal/models"
 	"kmem/internal/utils"
+	"log"
 	"time"
 )
 
@@ -35,3 +36,25 @@ func (pg *Postgres) QueryUser(username string) (models.User, error) {
 func (pg *Postgres) UpdateLastLogin(username string) error {
 	return pg.Exec(`UPDATE users SET last_login=$1 WHERE username=$2`, time.Now(), username)
 }
+
+// for jobs running over every account
+func (pg *Postgres) GetUsernames() ([]string, error) {
+	rows, err := pg.conn.Query(`SELECT username FROM users`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// entries whose writers have all finished. they are a prefix of the log:
+// an id above one still being written was inserted while that transaction ran
+const settled = "snapshot_xmax <= pg_snapshot_xmin(pg_current_snapshot())::text::BIGINT"
+
+func nullInt(n int) any {
+	if n == 0 {
+		return nil
+	}
+
+	return n
+}
+
+// written in the same tx as the change itself so the log never drifts
+func recordChange(ctx context.Context, tx *sql.Tx, c models.Change) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO changes(username,kind,file_id,album_id) VALUES($1,$2,$3,$4)
+	`, c.Username, c.Kind, nullInt(c.FileID), nullInt(c.AlbumID))
+	if err != nil {
+		return fmt.Errorf("failed to record %s change: %v", c.Kind, err)
+	}
+
+	return nil
+}
+
+// like Exec, records c when the query touched a row
+func (pg *Postgres) execChange(c models.Change, query string, args ...any) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(txctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		if err := recordChange(txctx, tx, c); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+// latest settled change id overall, a fresh token for full syncs. compaction
+// may have emptied the log, its tokens stay valid
+func (pg *Postgres) GetLatestChangeId() (int64, error) {
+	var id int64
+	err := pg.conn.QueryRow(`
+		SELECT GREATEST(
+			(SELECT COALESCE(MAX(id),0) FROM changes WHERE ` + settled + `),
+			(SELECT COALESCE(MAX(compacted_id),0) FROM sync_state)
+		)
+	`).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest change: %v", err)
+	}
+
+	return id, nil
+}
+
+func (pg *Postgres) GetCompactedChangeId() (int64, error) {
+	var id int64
+	err := pg.conn.QueryRow(`SELECT COALESCE(MAX(compacted_id),0) FROM sync_state`).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get compacted change: %v", err)
+	}
+
+	return id, nil
+}
+
+// the user's own changes and those of files or albums shared with them,
+// entries still in flight are held back so tokens never skip over them
+func (pg *Postgres) GetChangesSince(username string, since int64, limit int) ([]models.Change, error) {
+	rows, err := pg.conn.Query(`
+		SELECT c.id,c.username,c.kind,c.file_id,c.album_id,c.created_at FROM changes AS c
+		WHERE c.id>$2 AND c.`+settled+` AND (
+			c.username=$1
+			OR EXISTS (SELECT 1 FROM files WHERE files.id=c.file_id AND `+visibleTo("files", "$1")+`)
+			OR EXISTS (SELECT 1 FROM album_members WHERE album_id=c.album_id AND username=$1)
+		)
+		ORDER BY c.id ASC
+		LIMIT $3
+	`, username, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	changes := []models.Change{}
+	for rows.Next() {
+		var c models.Change
+		var fileId, albumId sql.NullInt64
+
+		if err := rows.Scan(&c.ID, &c.Username, &c.Kind, &fileId, &albumId, &c.CreatedAt); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		c.FileID = int(fileId.Int64)
+		c.AlbumID = int(albumId.Int64)
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// drops entries older than before and remembers the highest dropped id
+func (pg *Postgres) CompactChanges(before time.Time) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	var maxId sql.NullInt64
+	err = tx.QueryRowContext(txctx, `SELECT MAX(id) FROM changes WHERE created_at < $1`, before).Scan(&maxId)
+	if err != nil {
+		return fmt.Errorf("failed to find changes to compact: %v", err)
+	}
+
+	if !maxId.Valid {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(txctx, `DELETE FROM changes WHERE id <= $1`, maxId.Int64); err != nil {
+		return fmt.Errorf("failed to compact changes: %v", err)
+	}
+
+	_, err = tx.ExecContext(txctx, `
+		INSERT INTO sync_state(id,compacted_id) VALUES(1,$1)
+		ON CONFLICT (id) DO UPDATE SET compacted_id=GREATEST(sync_state.compacted_id,EXCLUDED.compacted_id)
+	`, maxId.Int64)
+	if err != nil {
+		return fmt.Errorf("failed to update sync state: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+// current gallery state of the given files, trashed & purged ones are left out
+func (pg *Postgres) GetFileResponsesByIds(username string, ids []int) ([]models.FileResponse, error) {
+	ids64 := make([]int64, len(ids))
+	for i, id := range ids {
+		ids64[i] = int64(id)
+	}
+
+	rows, err := pg.conn.Query(`
+		SELECT f.id,f.original_name,f.relative_path,f.mime_type,f.username,t.size_name,t.relative_path,t.width,t.height,t.format
+		FROM files AS f
+		LEFT JOIN thumbnails AS t ON f.id=t.file_id
+		WHERE `+visibleTo("f", "$1")+` AND f.deleted=false AND f.id = ANY($2)
+		ORDER BY f.id
+	`, username, pq.Array(ids64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	return pg.withRenditions(scanFileResponses(rows))
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// medium thumbnails of images never hashed or regenerated since, e.g. after an edit
+func (pg *Postgres) GetThumbnailsToHash(username string) ([]models.Thumbnail, error) {
+	rows, err := pg.conn.Query(`
+		SELECT t.file_id,t.file_path FROM thumbnails AS t
+		JOIN files AS f ON f.id=t.file_id
+		LEFT JOIN file_hashes AS h ON h.file_id=t.file_id
+		WHERE f.username=$1 AND f.deleted=false AND f.mime_type LIKE 'image/%'
+		AND t.size_name='medium' AND t.format IN ('jpeg','')
+		AND (h.file_id IS NULL OR h.created_at < t.created_at)
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thumbnails to hash: %v", err)
+	}
+	defer rows.Close()
+
+	var thumbs []models.Thumbnail
+	for rows.Next() {
+		t := models.Thumbnail{SizeName: "medium"}
+		if err := rows.Scan(&t.FileID, &t.FilePath); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		thumbs = append(thumbs, t)
+	}
+
+	return thumbs, nil
+}
+
+func (pg *Postgres) UpsertFileHash(fileId int, dhash, phash uint64) error {
+	err := pg.Exec(`
+		INSERT INTO file_hashes(file_id,dhash,phash) VALUES($1,$2,$3)
+		ON CONFLICT (file_id) DO UPDATE
+		SET dhash=EXCLUDED.dhash, phash=EXCLUDED.phash, paired=false, created_at=CURRENT_TIMESTAMP
+	`, fileId, int64(dhash), int64(phash))
+	if err != nil {
+		return fmt.Errorf("failed to save hash of %d: %v", fileId, err)
+	}
+
+	return nil
+}
+
+// every hashed file of the user still in the gallery
+func (pg *Postgres) GetHashedFiles(username string) ([]models.DuplicateFile, error) {
+	rows, err := pg.conn.Query(`
+		SELECT f.id,f.original_name,f.relative_path,COALESCE(t.relative_path,''),
+			COALESCE(m.width,0),COALESCE(m.height,0),f.file_size,f.taken_at,f.uploaded_at,h.dhash,h.phash,h.paired
+		FROM file_hashes AS h
+		JOIN files AS f ON f.id=h.file_id
+		LEFT JOIN file_metadata AS m ON m.file_id=f.id
+		LEFT JOIN thumbnails AS t ON t.file_id=f.id AND t.size_name='medium' AND t.format IN ('jpeg','')
+		WHERE f.username=$1 AND f.deleted=false
+		ORDER BY f.id
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hashed files: %v", err)
+	}
+	defer rows.Close()
+
+	var files []models.DuplicateFile
+	for rows.Next() {
+		var f models.DuplicateFile
+		var dhash, phash int64
+
+		err := rows.Scan(&f.ID, &f.OriginalName, &f.FilePath, &f.Thumbnail,
+			&f.Width, &f.Height, &f.FileSize, &f.TakenAt, &f.UploadedAt, &dhash, &phash, &f.Paired)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		f.DHash, f.PHash = uint64(dhash), uint64(phash)
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// replaces the pairs of the rehashed files and marks them paired
+func (pg *Postgres) SaveDuplicatePairs(fileIds []int, pairs []models.DuplicatePair) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	ids := pq.Array(toInt64s(fileIds))
+	if _, err := tx.ExecContext(txctx, `DELETE FROM duplicate_pairs WHERE file_a=ANY($1) OR file_b=ANY($1)`, ids); err != nil {
+		return fmt.Errorf("failed to clear duplicate pairs: %v", err)
+	}
+
+	as := make([]int64, len(pairs))
+	bs := make([]int64, len(pairs))
+	ds := make([]int64, len(pairs))
+	for i, p := range pairs {
+		as[i], bs[i], ds[i] = int64(p.FileA), int64(p.FileB), int64(p.Distance)
+	}
+
+	_, err = tx.ExecContext(txctx, `
+		INSERT INTO duplicate_pairs(file_a,file_b,distance)
+		SELECT * FROM unnest($1::INTEGER[],$2::INTEGER[],$3::SMALLINT[])
+		ON CONFLICT (file_a,file_b) DO UPDATE SET distance=EXCLUDED.distance
+	`, pq.Array(as), pq.Array(bs), pq.Array(ds))
+	if err != nil {
+		return fmt.Errorf("failed to save duplicate pairs: %v", err)
+	}
+
+	if _, err := tx.ExecContext(txctx, `UPDATE file_hashes SET paired=true WHERE file_id=ANY($1)`, ids); err != nil {
+		return fmt.Errorf("failed to mark files paired: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+// pairs within maxDistance between files of the user still in the gallery
+func (pg *Postgres) GetDuplicatePairs(username string, maxDistance int) ([]models.DuplicatePair, error) {
+	rows, err := pg.conn.Query(`
+		SELECT p.file_a,p.file_b,p.distance FROM duplicate_pairs AS p
+		JOIN files AS a ON a.id=p.file_a
+		JOIN files AS b ON b.id=p.file_b
+		WHERE a.username=$1 AND b.username=$1 AND a.deleted=false AND b.deleted=false AND p.distance<=$2
+	`, username, maxDistance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get duplicate pairs: %v", err)
+	}
+	defer rows.Close()
+
+	var pairs []models.DuplicatePair
+	for rows.Next() {
+		var p models.DuplicatePair
+		if err := rows.Scan(&p.FileA, &p.FileB, &p.Distance); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		pairs = append(pairs, p)
+	}
+
+	return pairs, nil
+}
+
+// moves files of the user to the trash, returns the ids actually trashed
+func (pg *Postgres) TrashFiles(username string, fileIds []int) ([]int, error) {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, len(fileIds))
+	for i, id := range fileIds {
+		ids[i] = int64(id)
+	}
+
+	rows, err := tx.QueryContext(txctx, `
+		UPDATE files SET deleted=true,deleted_at=$1
+		WHERE username=$2 AND id=ANY($3) AND deleted=false
+		RETURNING id
+	`, time.Now(), username, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to trash files: %v", err)
+	}
+
+	var trashed []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to trash files: %v", err)
+		}
+		trashed = append(trashed, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to trash files: %v", err)
+	}
+
+	for _, id := range trashed {
+		if err := recordChange(txctx, tx, models.Change{Username: username, Kind: models.ChangeFileDelete, FileID: id}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return trashed, nil
+}
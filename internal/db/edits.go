@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"kmem/internal/models"
+	"strconv"
+)
+
+// edits of a file, an empty stack at version 0 when it was never edited
+func (pg *Postgres) GetFileEdits(fileId int) (models.FileEdits, error) {
+	e := models.FileEdits{FileID: fileId, Ops: []models.EditOp{}}
+
+	var ops []byte
+	err := pg.conn.QueryRow(`SELECT ops,version,updated_at FROM file_edits WHERE file_id=$1`, fileId).
+		Scan(&ops, &e.Version, &e.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return e, nil
+	}
+	if err != nil {
+		return e, fmt.Errorf("failed to get edits of %d: %v", fileId, err)
+	}
+
+	if err := json.Unmarshal(ops, &e.Ops); err != nil {
+		return e, fmt.Errorf("invalid edits of %d: %v", fileId, err)
+	}
+
+	return e, nil
+}
+
+// pushes op onto the edit stack of a non-deleted file of the user
+func (pg *Postgres) AppendFileEdit(username, fileId string, op models.EditOp) (models.FileEdits, error) {
+	return pg.saveFileEdits(username, fileId, []models.EditOp{op}, `
+		INSERT INTO file_edits(file_id,ops,version) VALUES($1,$2,1)
+		ON CONFLICT (file_id) DO UPDATE
+		SET ops=file_edits.ops || EXCLUDED.ops, version=file_edits.version+1, updated_at=CURRENT_TIMESTAMP
+		RETURNING ops,version,updated_at
+	`)
+}
+
+// swaps the whole edit stack, an empty one reverts to the original. the
+// version keeps counting so reverted derivatives get fresh paths too
+func (pg *Postgres) ReplaceFileEdits(username, fileId string, ops []models.EditOp) (models.FileEdits, error) {
+	if ops == nil {
+		ops = []models.EditOp{}
+	}
+
+	return pg.saveFileEdits(username, fileId, ops, `
+		INSERT INTO file_edits(file_id,ops,version) VALUES($1,$2,1)
+		ON CONFLICT (file_id) DO UPDATE
+		SET ops=EXCLUDED.ops, version=file_edits.version+1, updated_at=CURRENT_TIMESTAMP
+		RETURNING ops,version,updated_at
+	`)
+}
+
+// runs an upsert of file_edits taking file id and ops, returning the new row
+func (pg *Postgres) saveFileEdits(username, fileId string, ops []models.EditOp, query string) (models.FileEdits, error) {
+	var e models.FileEdits
+
+	id, err := strconv.Atoi(fileId)
+	if err != nil {
+		return e, fmt.Errorf("invalid file id: %s", fileId)
+	}
+
+	opb, err := json.Marshal(ops)
+	if err != nil {
+		return e, err
+	}
+
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return e, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(txctx, `SELECT id FROM files WHERE username=$1 AND id=$2 AND deleted=false`, username, id).Scan(&e.FileID)
+	if err != nil {
+		return e, fmt.Errorf("failed to get file %d: %v", id, err)
+	}
+
+	var saved []byte
+	if err := tx.QueryRowContext(txctx, query, id, string(opb)).Scan(&saved, &e.Version, &e.UpdatedAt); err != nil {
+		return e, fmt.Errorf("failed to save edits of %d: %v", id, err)
+	}
+
+	if err := json.Unmarshal(saved, &e.Ops); err != nil {
+		return e, fmt.Errorf("invalid edits of %d: %v", id, err)
+	}
+
+	if err := recordChange(txctx, tx, models.Change{Username: username, Kind: models.ChangeFileEdit, FileID: id}); err != nil {
+		return e, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return e, fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return e, nil
+}
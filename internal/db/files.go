@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"kmem/internal/models"
 	"log"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 func (pg *Postgres) InsertFile(file models.File) (int, error) {
@@ -23,16 +27,23 @@ func (pg *Postgres) InsertFile(file models.File) (int, error) {
 	// check existing file
 	var id int
 	var deleted bool
-	err = tx.QueryRowContext(txctx, `SELECT id,deleted FROM files WHERE hash=$1`, file.Hash).Scan(&id, &deleted)
+	var owner string
+	err = tx.QueryRowContext(txctx, `SELECT id,deleted,username FROM files WHERE hash=$1`, file.Hash).Scan(&id, &deleted, &owner)
 	if err == nil { // file exists
-		fmt.Println(id, deleted)
+		// hashes are unique across accounts, another user's copy is never touched
+		if owner != file.Username {
+			return id, fmt.Errorf("file already exists")
+		}
 
 		if deleted {
 			if _, err := tx.ExecContext(txctx, `UPDATE files SET deleted=$1,deleted_at=$2 WHERE id=$3`, false, nil, id); err != nil {
-				fmt.Println(err)
 				return 0, fmt.Errorf("failed to update deleted file: %v", err)
 			}
 
+			if err := recordChange(txctx, tx, models.Change{Username: owner, Kind: models.ChangeFileRestore, FileID: id}); err != nil {
+				return 0, err
+			}
+
 			if err := tx.Commit(); err != nil {
 				return 0, fmt.Errorf("failed to commit tx: %v", err)
 			}
@@ -45,14 +56,18 @@ func (pg *Postgres) InsertFile(file models.File) (int, error) {
 
 	// new file
 	err = tx.QueryRowContext(txctx, `
-	INSERT INTO files(username,hash,original_name,stored_name,file_path,relative_path,file_size,mime_type)
-	VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+	INSERT INTO files(username,hash,original_name,stored_name,file_path,relative_path,file_size,mime_type,folder_id)
+	VALUES($1,$2,$3,$4,$5,$6,$7,$8,(SELECT id FROM folders WHERE id=$9 AND username=$1))
 	RETURNING id
-	`, file.Username, file.Hash, file.OriginalName, file.StoredName, file.FilePath, file.RelativePath, file.FileSize, file.MimeType).Scan(&id)
+	`, file.Username, file.Hash, file.OriginalName, file.StoredName, file.FilePath, file.RelativePath, file.FileSize, file.MimeType, file.FolderID).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
 
+	if err := recordChange(txctx, tx, models.Change{Username: file.Username, Kind: models.ChangeFileInsert, FileID: id}); err != nil {
+		return 0, err
+	}
+
 	// rowsAffected, err := result.RowsAffected()
 	// if err != nil {
 	// 	return -1, err
@@ -69,20 +84,176 @@ func (pg *Postgres) InsertFile(file models.File) (int, error) {
 	return id, nil
 }
 
-func (pg *Postgres) GetFilesCount(username, typeStr, searchStr string) (int, error) {
-	whereClause := "WHERE username=$1 AND deleted=$2"
+// hashes are unique across all users
+func (pg *Postgres) QueryFileByHash(hash string) (models.File, error) {
+	var file models.File
+
+	err := pg.conn.QueryRow(`SELECT id,username,deleted FROM files WHERE hash=$1`, hash).Scan(&file.ID, &file.Username, &file.Deleted)
+	if err != nil {
+		return file, fmt.Errorf("failed to query file by hash: %v", err)
+	}
+
+	file.Hash = hash
+
+	return file, nil
+}
+
+// a file the user can see, own or shared through an album, for read only uses
+func (pg *Postgres) QueryVisibleFile(username, fileId string) (models.File, error) {
+	rows, err := pg.conn.Query(`
+		SELECT id,hash,username,original_name,stored_name,file_path,relative_path,file_size,mime_type,uploaded_at,taken_at,caption
+		FROM files
+		WHERE id=$2 AND deleted=false AND `+visibleTo("files", "$1"), username, fileId)
+	if err != nil {
+		return models.File{}, fmt.Errorf("failed to query file %s: %v", fileId, err)
+	}
+	defer rows.Close()
+
+	files := scanFiles(rows)
+	if len(files) == 0 {
+		return models.File{}, fmt.Errorf("file not found: %s", fileId)
+	}
+
+	return files[0], nil
+}
+
+// a non-deleted file of the user with every column scanFiles reads
+func (pg *Postgres) QueryFile(username, fileId string) (models.File, error) {
+	rows, err := pg.conn.Query(`
+		SELECT id,hash,username,original_name,stored_name,file_path,relative_path,file_size,mime_type,uploaded_at,taken_at,caption
+		FROM files
+		WHERE username=$1 AND id=$2 AND deleted=false
+	`, username, fileId)
+	if err != nil {
+		return models.File{}, fmt.Errorf("failed to query file %s: %v", fileId, err)
+	}
+	defer rows.Close()
+
+	files := scanFiles(rows)
+	if len(files) == 0 {
+		return models.File{}, fmt.Errorf("file not found: %s", fileId)
+	}
+
+	return files[0], nil
+}
+
+// hash -> file, only files of the user
+func (pg *Postgres) GetFilesByHashes(username string, hashes []string) (map[string]models.File, error) {
+	rows, err := pg.conn.Query(`
+		SELECT id,username,hash,file_size,deleted FROM files WHERE username=$1 AND hash = ANY($2)
+	`, username, pq.Array(hashes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files by hashes: %v", err)
+	}
+	defer rows.Close()
+
+	fmap := make(map[string]models.File)
+	for rows.Next() {
+		var file models.File
+		var fileSize sql.NullInt64
+
+		if err := rows.Scan(&file.ID, &file.Username, &file.Hash, &fileSize, &file.Deleted); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		file.FileSize = fileSize.Int64
+		fmap[file.Hash] = file
+	}
+
+	return fmap, nil
+}
+
+// where clause of the gallery on files: the user's own media (images, videos,
+// audio) and the media shared through albums, general files only show in
+// folders. stack members are hidden behind their primary as long as the
+// primary is in the same view. ownedOnly leaves out files shared with the
+// user, smart albums are evaluated that way so members only see the owner's
+// files. an uploader filter picks other accounts' files on purpose, so it
+// keeps the shared ones the user can see
+func galleryWhere(username string, filter models.FileFilter, ownedOnly bool) (string, []any) {
 	args := []any{username, false}
+	param := func(v any) int {
+		args = append(args, v)
+		return len(args)
+	}
+
+	// {f} is the files table the filters apply to
+	var filters string
+	if len(filter.Type) > 0 && filter.Type != "all" {
+		filters += fmt.Sprintf(" AND {f}.mime_type LIKE $%d", param(filter.Type+"%"))
+	}
+
+	// by name, by the place it was taken at or by audio tags
+	if len(filter.Search) > 2 {
+		filters += fmt.Sprintf(` AND ({f}.original_name ILIKE $%[1]d OR EXISTS (
+			SELECT 1 FROM file_metadata AS gm WHERE gm.file_id={f}.id
+			AND (gm.city ILIKE $%[1]d OR gm.region ILIKE $%[1]d OR gm.country ILIKE $%[1]d
+				OR gm.title ILIKE $%[1]d OR gm.artist ILIKE $%[1]d OR gm.album ILIKE $%[1]d)
+		))`, param("%"+filter.Search+"%"))
+	}
+
+	if len(filter.Tags) > 0 {
+		filters += fmt.Sprintf(` AND (
+			SELECT COUNT(*) FROM file_tags AS ft JOIN tags AS tg ON tg.id=ft.tag_id
+			WHERE ft.file_id={f}.id AND tg.name=ANY($%d)
+		)=$%d`, param(pq.Array(filter.Tags)), param(len(filter.Tags)))
+	}
+
+	if filter.From != nil {
+		filters += fmt.Sprintf(" AND COALESCE({f}.taken_at,{f}.uploaded_at)>=$%d", param(*filter.From))
+	}
+
+	if filter.To != nil {
+		filters += fmt.Sprintf(" AND COALESCE({f}.taken_at,{f}.uploaded_at)<=$%d", param(*filter.To))
+	}
 
-	if typeStr != "all" {
-		whereClause += " AND mime_type LIKE $2"
-		args = append(args, typeStr+"%")
+	if len(filter.Camera) > 0 {
+		filters += fmt.Sprintf(` AND EXISTS (
+			SELECT 1 FROM file_metadata AS cm WHERE cm.file_id={f}.id
+			AND (cm.camera_make ILIKE $%[1]d OR cm.camera_model ILIKE $%[1]d)
+		)`, param("%"+filter.Camera+"%"))
 	}
 
-	if len(searchStr) > 2 {
-		whereClause += fmt.Sprintf(" AND original_name ILIKE $%d", len(args)+1)
-		args = append(args, "%"+searchStr+"%")
+	if len(filter.Place) > 0 {
+		filters += fmt.Sprintf(` AND EXISTS (
+			SELECT 1 FROM file_metadata AS pm WHERE pm.file_id={f}.id
+			AND (pm.city ILIKE $%[1]d OR pm.region ILIKE $%[1]d OR pm.country ILIKE $%[1]d)
+		)`, param("%"+filter.Place+"%"))
 	}
 
+	if filter.MinSize > 0 {
+		filters += fmt.Sprintf(" AND {f}.file_size>=$%d", param(filter.MinSize))
+	}
+
+	if filter.MaxSize > 0 {
+		filters += fmt.Sprintf(" AND {f}.file_size<=$%d", param(filter.MaxSize))
+	}
+
+	if len(filter.Uploader) > 0 {
+		filters += fmt.Sprintf(" AND {f}.username=$%d", param(filter.Uploader))
+	}
+
+	visible := visibleTo("files", "$1")
+	if ownedOnly && len(filter.Uploader) == 0 {
+		visible = "files.username=$1"
+	}
+
+	whereClause := "WHERE " + visible + ` AND files.deleted=$2
+		AND (files.mime_type LIKE 'image/%' OR files.mime_type LIKE 'video/%' OR files.mime_type LIKE 'audio/%')` + strings.ReplaceAll(filters, "{f}", "files") + `
+		AND NOT EXISTS (
+			SELECT 1 FROM stack_files AS sf
+			JOIN stacks AS s ON s.id=sf.stack_id
+			JOIN files AS p ON p.id=s.primary_file_id
+			WHERE sf.file_id=files.id AND p.id<>files.id AND p.deleted=false` + strings.ReplaceAll(filters, "{f}", "p") + `
+		)`
+
+	return whereClause, args
+}
+
+func (pg *Postgres) GetFilesCount(username string, filter models.FileFilter, ownedOnly bool) (int, error) {
+	whereClause, args := galleryWhere(username, filter, ownedOnly)
+
 	query := fmt.Sprintf("SELECT COUNT(*) FROM files %s", whereClause)
 
 	var count int
@@ -93,7 +264,7 @@ func (pg *Postgres) GetFilesCount(username, typeStr, searchStr string) (int, err
 	return count, nil
 }
 
-func (pg *Postgres) GetFilesPage(username string, page, limit int, sort, typeStr, searchStr string) ([]models.FileResponse, error) {
+func (pg *Postgres) GetFilesPage(username string, page, limit int, sort string, filter models.FileFilter, ownedOnly bool) ([]models.FileResponse, error) {
 	offset := page * limit
 
 	orderby := "uploaded_at DESC" // default
@@ -103,22 +274,11 @@ func (pg *Postgres) GetFilesPage(username string, page, limit int, sort, typeStr
 		orderby = "original_name ASC"
 	}
 
-	whereClause := "WHERE username=$1 AND deleted=$2"
-	args := []any{username, false}
-
-	if typeStr != "all" {
-		whereClause += " AND mime_type LIKE $3"
-		args = append(args, typeStr+"%")
-	}
-
-	if len(searchStr) > 2 {
-		whereClause += fmt.Sprintf(" AND original_name ILIKE $%d", len(args)+1)
-		args = append(args, "%"+searchStr+"%")
-	}
+	whereClause, args := galleryWhere(username, filter, ownedOnly)
 
 	query := fmt.Sprintf(`
-		SELECT f.id,f.original_name,f.relative_path,f.mime_type,t.size_name,t.relative_path FROM (
-			SELECT id, original_name, relative_path, mime_type
+		SELECT f.id,f.original_name,f.relative_path,f.mime_type,f.username,t.size_name,t.relative_path,t.width,t.height,t.format FROM (
+			SELECT id, original_name, relative_path, mime_type, username
         	FROM files 
         	%s
         	ORDER BY %s
@@ -135,67 +295,106 @@ func (pg *Postgres) GetFilesPage(username string, page, limit int, sort, typeStr
 	}
 	defer rows.Close()
 
+	files, err := pg.withRenditions(scanFileResponses(rows))
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.withStacks(files)
+}
+
+// rows: file id, original name, relative path, mime type, owner, thumbnail size, thumbnail path,
+// thumbnail width, thumbnail height, thumbnail format
+// one row per thumbnail, grouped back into files keeping the row order
+func scanFileResponses(rows *sql.Rows) []models.FileResponse {
 	filesMap := make(map[int]models.FileResponse)
+	var order []int
+
 	for rows.Next() {
 		var file models.FileResponse
 
 		file.Thumbnails = make(map[string]models.ThumbnailResponse)
 
-		var sizeName, thumbPath sql.NullString
+		var sizeName, thumbPath, thumbFormat sql.NullString
+		var thumbWidth, thumbHeight sql.NullInt64
 
-		if err := rows.Scan(&file.ID, &file.OriginalName, &file.FilePath, &file.MimeType, &sizeName, &thumbPath); err != nil {
+		err := rows.Scan(&file.ID, &file.OriginalName, &file.FilePath, &file.MimeType, &file.Uploader,
+			&sizeName, &thumbPath, &thumbWidth, &thumbHeight, &thumbFormat)
+		if err != nil {
 			log.Println(err)
 			continue
 		}
 
-		var thumb models.ThumbnailResponse
-		if sizeName.Valid && thumbPath.Valid {
-			thumb.SizeName = sizeName.String
-			thumb.FilePath = thumbPath.String
+		f, ok := filesMap[file.ID]
+		if !ok {
+			f = file
+			filesMap[file.ID] = f
+			order = append(order, file.ID)
 		}
 
-		_, ok := filesMap[file.ID]
-		if ok {
-			filesMap[file.ID].Thumbnails[thumb.SizeName] = thumb
+		if !sizeName.Valid || !thumbPath.Valid {
+			continue
+		}
+
+		// alternates only add to the formats of the fallback
+		t := f.Thumbnails[sizeName.String]
+		if models.IsAlternateFormat(thumbFormat.String) {
+			t.Formats = append(t.Formats, thumbFormat.String)
 		} else {
-			filesMap[file.ID] = file
+			t.SizeName = sizeName.String
+			t.FilePath = thumbPath.String
+			t.Width = int(thumbWidth.Int64)
+			t.Height = int(thumbHeight.Int64)
 		}
+		f.Thumbnails[sizeName.String] = t
 	}
 
 	var files []models.FileResponse
 
-	for _, f := range filesMap {
-		files = append(files, f)
+	for _, id := range order {
+		files = append(files, filesMap[id])
 	}
 
-	return files, nil
+	return files
 }
 
-// soft remove files - local files will be deleted after some time
-func (pg *Postgres) DeleteFileSoft(username, fileId string) error {
+// soft remove files - local files will be deleted after some time. false
+// when the file was trashed already or the user can't change it
+func (pg *Postgres) DeleteFileSoft(username, fileId string) (bool, error) {
 	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
 	defer cancel()
 
 	tx, err := pg.conn.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin tx: %v", err)
+		return false, fmt.Errorf("failed to begin tx: %v", err)
 	}
 	defer tx.Rollback()
 
-	_, err = tx.ExecContext(txctx, `
+	// editors of a shared album can trash the files in it, the change is the owner's
+	var id int
+	var owner string
+	err = tx.QueryRowContext(txctx, `
 	UPDATE files
 	SET deleted=$1,deleted_at=$2
-	WHERE username=$3 AND id=$4`,
-		true, time.Now(), username, fileId)
+	WHERE id=$4 AND deleted=$5 AND `+editableBy("files", "$3")+`
+	RETURNING id,username`,
+		true, time.Now(), username, fileId, false).Scan(&id, &owner)
+	if err == sql.ErrNoRows {
+		return false, nil // already in trash or not the user's file
+	}
 	if err != nil {
-		return fmt.Errorf("failed to delete soft file from db: %s: %v", fileId, err)
+		return false, fmt.Errorf("failed to delete soft file from db: %s: %v", fileId, err)
+	}
+
+	if err := recordChange(txctx, tx, models.Change{Username: owner, Kind: models.ChangeFileDelete, FileID: id}); err != nil {
+		return false, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit tx: %v", err)
+		return false, fmt.Errorf("failed to commit tx: %v", err)
 	}
 
-	return nil
+	return true, nil
 }
 
 func (pg *Postgres) DeleteFileHard(fileId int) error {
@@ -208,13 +407,21 @@ func (pg *Postgres) DeleteFileHard(fileId int) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.ExecContext(txctx, `
-		DELETE FROM files WHERE id=$1
-	`, fileId)
+	var owner string
+	err = tx.QueryRowContext(txctx, `
+		DELETE FROM files WHERE id=$1 RETURNING username
+	`, fileId).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete file from db: %v", err)
 	}
 
+	if err := recordChange(txctx, tx, models.Change{Username: owner, Kind: models.ChangeFilePurge, FileID: fileId}); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit tx: %v", err)
 	}
@@ -222,26 +429,48 @@ func (pg *Postgres) DeleteFileHard(fileId int) error {
 	return nil
 }
 
-func (pg *Postgres) RenameFile(username, fileId, newName string) error {
+func (pg *Postgres) RenameFile(username, fileId, newName string) (bool, error) {
 	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
 	defer cancel()
 
 	tx, err := pg.conn.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin tx: %v", err)
+		return false, fmt.Errorf("failed to begin tx: %v", err)
 	}
 	defer tx.Rollback()
 
-	_, err = tx.ExecContext(txctx, `UPDATE files SET original_name=$1 WHERE username=$2 AND id=$3 AND deleted=$4`, newName, username, fileId, false)
+	var id int
+	var owner string
+	err = tx.QueryRowContext(txctx, `
+		UPDATE files SET original_name=$1 WHERE id=$3 AND deleted=$4 AND `+editableBy("files", "$2")+`
+		RETURNING id,username
+	`, newName, username, fileId, false).Scan(&id, &owner)
+	if err == sql.ErrNoRows {
+		return false, nil // trashed or not the user's file
+	}
 	if err != nil {
-		return fmt.Errorf("failed to rename file: %s: %v", fileId, err)
+		return false, fmt.Errorf("failed to rename file: %s: %v", fileId, err)
+	}
+
+	if err := recordChange(txctx, tx, models.Change{Username: owner, Kind: models.ChangeFileRename, FileID: id}); err != nil {
+		return false, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit tx: %v", err)
+		return false, fmt.Errorf("failed to commit tx: %v", err)
 	}
 
-	return nil
+	return true, nil
+}
+
+func (pg *Postgres) UpdateCaption(username, fileId, caption string) error {
+	id, err := strconv.Atoi(fileId)
+	if err != nil {
+		return fmt.Errorf("invalid file id: %s", fileId)
+	}
+
+	return pg.execChange(models.Change{Username: username, Kind: models.ChangeFileUpdate, FileID: id},
+		`UPDATE files SET caption=$1 WHERE username=$2 AND id=$3 AND deleted=$4`, caption, username, id, false)
 }
 
 // for cleanup & syncing
@@ -283,6 +512,80 @@ func (pg *Postgres) GetAllFilesToCheck() (map[string]models.DelFile, error) {
 	return dmap, nil
 }
 
+func (pg *Postgres) GetFilesForDownload(username string, req models.DownloadRequest) ([]models.File, error) {
+	whereClause := "WHERE username=$1 AND deleted=$2"
+	args := []any{username, false}
+
+	if len(req.FileIDs) > 0 {
+		ids := make([]int64, len(req.FileIDs))
+		for i, id := range req.FileIDs {
+			ids[i] = int64(id)
+		}
+
+		args = append(args, pq.Array(ids))
+		whereClause += fmt.Sprintf(" AND id = ANY($%d)", len(args))
+	}
+
+	// members download a shared album whole, other selections stay the user's own
+	if req.AlbumID > 0 {
+		args = append(args, req.AlbumID)
+		whereClause = "WHERE " + visibleTo("files", "$1") + " AND deleted=$2"
+		whereClause += fmt.Sprintf(` AND id IN (
+			SELECT af.file_id FROM album_files AS af
+			JOIN albums AS a ON a.id=af.album_id
+			WHERE a.id=$%d AND (a.username=$1 OR EXISTS (SELECT 1 FROM album_members WHERE album_id=a.id AND username=$1)))`, len(args))
+	}
+
+	if req.From != nil {
+		args = append(args, *req.From)
+		whereClause += fmt.Sprintf(" AND COALESCE(taken_at,uploaded_at) >= $%d", len(args))
+	}
+
+	if req.To != nil {
+		args = append(args, *req.To)
+		whereClause += fmt.Sprintf(" AND COALESCE(taken_at,uploaded_at) < $%d", len(args))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id,hash,username,original_name,stored_name,file_path,relative_path,file_size,mime_type,uploaded_at,taken_at,caption
+		FROM files
+		%s
+		ORDER BY COALESCE(taken_at,uploaded_at) ASC
+	`, whereClause)
+
+	rows, err := pg.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files to download for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	return scanFiles(rows), nil
+}
+
+// rows: every column of models.File up to caption, in declaration order
+func scanFiles(rows *sql.Rows) []models.File {
+	var files []models.File
+	for rows.Next() {
+		var file models.File
+		var mimeType, caption sql.NullString
+		var fileSize sql.NullInt64
+
+		err := rows.Scan(&file.ID, &file.Hash, &file.Username, &file.OriginalName, &file.StoredName, &file.FilePath,
+			&file.RelativePath, &fileSize, &mimeType, &file.UploadedAt, &file.TakenAt, &caption)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		file.FileSize = fileSize.Int64
+		file.MimeType = mimeType.String
+		file.Caption = caption.String
+		files = append(files, file)
+	}
+
+	return files
+}
+
 func (pg *Postgres) GetUserFilesUsage(username string) (int, int64, error) {
 	var cnt int
 	var totalSize int64
@@ -297,3 +600,36 @@ func (pg *Postgres) GetUserFilesUsage(username string) (int, int64, error) {
 
 	return cnt, totalSize, nil
 }
+
+// originals and thumbnails by their /static path
+func (pg *Postgres) GetStaticEntry(relPath string) (models.StaticEntry, error) {
+	var e models.StaticEntry
+
+	err := pg.conn.QueryRow(`
+		SELECT id,hash,original_name,'','' FROM files WHERE relative_path=$1
+		UNION ALL
+		SELECT f.id,f.hash,f.original_name,t.size_name,t.format FROM thumbnails AS t
+		JOIN files AS f ON f.id=t.file_id
+		WHERE t.relative_path=$1
+		LIMIT 1
+	`, relPath).Scan(&e.FileID, &e.Hash, &e.OriginalName, &e.Variant, &e.Format)
+	if err != nil {
+		return e, fmt.Errorf("failed to get static entry %s: %v", relPath, err)
+	}
+
+	return e, nil
+}
+
+// for derivatives kept in a per file directory, e.g. hls renditions
+func (pg *Postgres) GetStaticEntryByStoredName(username, storedName, variant string) (models.StaticEntry, error) {
+	e := models.StaticEntry{Variant: variant}
+
+	err := pg.conn.QueryRow(`
+		SELECT id,hash,original_name FROM files WHERE username=$1 AND stored_name=$2
+	`, username, storedName).Scan(&e.FileID, &e.Hash, &e.OriginalName)
+	if err != nil {
+		return e, fmt.Errorf("failed to get static entry %s/%s: %v", username, storedName, err)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,278 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// subfolders of parent, nil for the root, with the size and file count of
+// everything below each of them
+func (pg *Postgres) GetFolders(username string, parentId *int) ([]models.Folder, error) {
+	rows, err := pg.conn.Query(`
+		WITH RECURSIVE tree AS (
+			SELECT id AS root, id FROM folders
+			WHERE username=$1 AND parent_id IS NOT DISTINCT FROM $2::INTEGER
+			UNION ALL
+			SELECT t.root, f.id FROM folders AS f JOIN tree AS t ON f.parent_id=t.id
+		) CYCLE id SET is_cycle USING path
+		SELECT fo.id,fo.parent_id,fo.name,fo.created_at,COALESCE(SUM(fi.file_size),0),COUNT(fi.id)
+		FROM folders AS fo
+		JOIN tree AS t ON t.root=fo.id AND NOT t.is_cycle
+		LEFT JOIN files AS fi ON fi.folder_id=t.id AND fi.deleted=false
+		GROUP BY fo.id
+		ORDER BY fo.name
+	`, username, parentId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folders of %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		f := models.Folder{Username: username}
+		if err := rows.Scan(&f.ID, &f.ParentID, &f.Name, &f.CreatedAt, &f.Size, &f.FileCount); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		folders = append(folders, f)
+	}
+
+	return folders, nil
+}
+
+// path from the root down to the folder, empty when it isn't the user's
+func (pg *Postgres) GetBreadcrumb(username string, folderId int) ([]models.Crumb, error) {
+	rows, err := pg.conn.Query(`
+		WITH RECURSIVE up AS (
+			SELECT id,parent_id,name,0 AS depth FROM folders WHERE id=$1 AND username=$2
+			UNION ALL
+			SELECT f.id,f.parent_id,f.name,u.depth+1 FROM folders AS f JOIN up AS u ON f.id=u.parent_id
+		) CYCLE id SET is_cycle USING path
+		SELECT id,name FROM up WHERE NOT is_cycle ORDER BY depth DESC
+	`, folderId, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get breadcrumb of folder %d: %v", folderId, err)
+	}
+	defer rows.Close()
+
+	crumbs := []models.Crumb{}
+	for rows.Next() {
+		var c models.Crumb
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		crumbs = append(crumbs, c)
+	}
+
+	return crumbs, nil
+}
+
+// files directly in the folder, nil for the root, by name. thumbnails are
+// jpeg, png for audio waveforms, never the alternate formats
+func (pg *Postgres) GetFolderFiles(username string, folderId *int, page, limit int) ([]models.FolderFile, error) {
+	rows, err := pg.conn.Query(`
+		SELECT f.id,f.original_name,f.mime_type,f.relative_path,f.file_size,f.uploaded_at,t.relative_path
+		FROM files AS f
+		LEFT JOIN thumbnails AS t ON t.file_id=f.id AND t.size_name='small' AND t.format IN ('jpeg','png','')
+		WHERE f.username=$1 AND f.deleted=false AND f.folder_id IS NOT DISTINCT FROM $2::INTEGER
+		ORDER BY f.original_name,f.id
+		LIMIT $3 OFFSET $4
+	`, username, folderId, limit, page*limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder files of %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	files := []models.FolderFile{}
+	for rows.Next() {
+		var f models.FolderFile
+		var size *int64
+		var thumb sql.NullString
+		if err := rows.Scan(&f.ID, &f.OriginalName, &f.MimeType, &f.FilePath, &size, &f.UploadedAt, &thumb); err != nil {
+			log.Println(err)
+			continue
+		}
+		if size != nil {
+			f.FileSize = *size
+		}
+		f.Thumbnail = thumb.String
+
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func (pg *Postgres) FolderNameTaken(username string, parentId *int, name string) (bool, error) {
+	var taken bool
+
+	err := pg.conn.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM folders WHERE username=$1 AND parent_id IS NOT DISTINCT FROM $2::INTEGER AND name=$3
+		)
+	`, username, parentId, name).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("failed to check folder name %s: %v", name, err)
+	}
+
+	return taken, nil
+}
+
+// the parent must be one of the user's folders
+func (pg *Postgres) CreateFolder(username, name string, parentId *int) (models.Folder, error) {
+	folder := models.Folder{Username: username, ParentID: parentId, Name: name}
+
+	err := pg.conn.QueryRow(`
+		INSERT INTO folders(username,parent_id,name)
+		SELECT $1,$2::INTEGER,$3
+		WHERE $2::INTEGER IS NULL OR EXISTS (SELECT 1 FROM folders WHERE id=$2 AND username=$1)
+		RETURNING id,created_at
+	`, username, parentId, name).Scan(&folder.ID, &folder.CreatedAt)
+	if err != nil {
+		return folder, fmt.Errorf("failed to create folder %s: %v", name, err)
+	}
+
+	return folder, nil
+}
+
+func (pg *Postgres) RenameFolder(username, folderId, name string) error {
+	_, err := pg.conn.Exec(`UPDATE folders SET name=$1 WHERE id=$2 AND username=$3`, name, folderId, username)
+	if err != nil {
+		return fmt.Errorf("failed to rename folder %s: %v", folderId, err)
+	}
+
+	return nil
+}
+
+// false when the folder or the parent isn't the user's or the parent is
+// the folder itself or below it
+func (pg *Postgres) MoveFolder(username, folderId string, parentId *int) (bool, error) {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	// two moves checked against the same tree could close a loop together,
+	// moves of a user wait for each other instead
+	_, err = tx.ExecContext(txctx, `SELECT id FROM folders WHERE username=$1 FOR UPDATE`, username)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock folders of %s: %v", username, err)
+	}
+
+	res, err := tx.ExecContext(txctx, `
+		WITH RECURSIVE below AS (
+			SELECT id FROM folders WHERE id=$1
+			UNION ALL
+			SELECT f.id FROM folders AS f JOIN below AS b ON f.parent_id=b.id
+		) CYCLE id SET is_cycle USING path
+		UPDATE folders SET parent_id=$3::INTEGER
+		WHERE id=$1 AND username=$2 AND (
+			$3::INTEGER IS NULL OR (
+				$3 NOT IN (SELECT id FROM below)
+				AND EXISTS (SELECT 1 FROM folders WHERE id=$3 AND username=$2)
+			)
+		)
+	`, folderId, username, parentId)
+	if err != nil {
+		return false, fmt.Errorf("failed to move folder %s: %v", folderId, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to move folder %s: %v", folderId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return n > 0, nil
+}
+
+// empty folders only, false otherwise
+func (pg *Postgres) DeleteFolder(username, folderId string) (bool, error) {
+	res, err := pg.conn.Exec(`
+		DELETE FROM folders AS fo
+		WHERE fo.id=$1 AND fo.username=$2
+		AND NOT EXISTS (SELECT 1 FROM folders WHERE parent_id=fo.id)
+		AND NOT EXISTS (SELECT 1 FROM files WHERE folder_id=fo.id AND deleted=false)
+	`, folderId, username)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete folder %s: %v", folderId, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete folder %s: %v", folderId, err)
+	}
+
+	return n > 0, nil
+}
+
+// moves the user's files into the folder, nil for the root
+func (pg *Postgres) MoveFiles(username string, fileIds []int, folderId *int) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	if folderId != nil {
+		var ok bool
+		err := tx.QueryRowContext(txctx, `SELECT EXISTS (SELECT 1 FROM folders WHERE id=$1 AND username=$2)`,
+			*folderId, username).Scan(&ok)
+		if err != nil {
+			return fmt.Errorf("failed to check folder %d: %v", *folderId, err)
+		}
+		if !ok {
+			return fmt.Errorf("folder not found: %d", *folderId)
+		}
+	}
+
+	rows, err := tx.QueryContext(txctx, `
+		UPDATE files SET folder_id=$1
+		WHERE username=$2 AND id=ANY($3) AND folder_id IS DISTINCT FROM $1::INTEGER
+		RETURNING id
+	`, folderId, username, pq.Array(toInt64s(fileIds)))
+	if err != nil {
+		return fmt.Errorf("failed to move files: %v", err)
+	}
+
+	var moved []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to move files: %v", err)
+		}
+		moved = append(moved, id)
+	}
+	rows.Close()
+
+	for _, id := range moved {
+		if err := recordChange(txctx, tx, models.Change{Username: username, Kind: models.ChangeFileMove, FileID: id}); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
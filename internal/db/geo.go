@@ -0,0 +1,65 @@
+package db
+
+import (
+	"fmt"
+	"kmem/internal/models"
+	"log"
+)
+
+// located gallery files inside bbox grouped on a cells x cells grid,
+// filtered like GetFilesPage
+func (pg *Postgres) GetGeoClusters(username string, filter models.FileFilter, bbox models.BBox, cells int) ([]models.GeoCluster, error) {
+	whereClause, args := galleryWhere(username, filter, false)
+
+	// a box over the antimeridian is unwrapped past 180
+	maxLon := bbox.MaxLon
+	if bbox.MinLon > maxLon {
+		maxLon += 360
+	}
+
+	n := len(args)
+	args = append(args, bbox.MinLon, bbox.MinLat, maxLon, bbox.MaxLat,
+		(maxLon-bbox.MinLon)/float64(cells), (bbox.MaxLat-bbox.MinLat)/float64(cells))
+
+	query := fmt.Sprintf(`
+		SELECT c.count,c.lat,c.lon,c.file_id,COALESCE(t.relative_path,'') FROM (
+			SELECT COUNT(*) AS count,AVG(p.lat) AS lat,AVG(p.lon) AS lon,
+				(array_agg(p.id ORDER BY p.captured DESC,p.id DESC))[1] AS file_id
+			FROM (
+				SELECT files.id,m.latitude AS lat,
+					CASE WHEN m.longitude < $%[2]d THEN m.longitude+360 ELSE m.longitude END AS lon,
+					COALESCE(files.taken_at,files.uploaded_at) AS captured
+				FROM files
+				JOIN file_metadata AS m ON m.file_id=files.id
+				%[1]s
+				AND m.longitude IS NOT NULL AND m.latitude BETWEEN $%[3]d AND $%[5]d
+			) AS p
+			WHERE p.lon BETWEEN $%[2]d AND $%[4]d
+			GROUP BY floor((p.lon-$%[2]d)/$%[6]d),floor((p.lat-$%[3]d)/$%[7]d)
+		) AS c
+		LEFT JOIN thumbnails AS t ON t.file_id=c.file_id AND t.size_name='small' AND t.format IN ('jpeg','')
+	`, whereClause, n+1, n+2, n+3, n+4, n+5, n+6)
+
+	rows, err := pg.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geo clusters for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	clusters := []models.GeoCluster{}
+	for rows.Next() {
+		var c models.GeoCluster
+		if err := rows.Scan(&c.Count, &c.Latitude, &c.Longitude, &c.FileID, &c.Thumbnail); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if c.Longitude > 180 {
+			c.Longitude -= 360
+		}
+
+		clusters = append(clusters, c)
+	}
+
+	return clusters, nil
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+	"time"
+)
+
+func (pg *Postgres) InsertJob(job models.Job) (int, error) {
+	var id int
+	err := pg.conn.QueryRow(`
+		INSERT INTO jobs(username,kind,status,total)
+		VALUES($1,$2,$3,$4)
+		RETURNING id
+	`, job.Username, job.Kind, models.JobPending, job.Total).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert job: %v", err)
+	}
+
+	return id, nil
+}
+
+func (pg *Postgres) QueryJob(username string, jobId string) (models.Job, error) {
+	var job models.Job
+	var filePath, errStr, result sql.NullString
+
+	err := pg.conn.QueryRow(`
+		SELECT id,username,kind,status,progress,total,file_path,error,result,created_at,updated_at,expires_at
+		FROM jobs
+		WHERE username=$1 AND id=$2
+	`, username, jobId).Scan(&job.ID, &job.Username, &job.Kind, &job.Status, &job.Progress, &job.Total,
+		&filePath, &errStr, &result, &job.CreatedAt, &job.UpdatedAt, &job.ExpiresAt)
+	if err != nil {
+		return job, fmt.Errorf("failed to query job: %v", err)
+	}
+
+	job.FilePath = filePath.String
+	job.Error = errStr.String
+	if result.Valid {
+		job.Result = json.RawMessage(result.String)
+	}
+
+	return job, nil
+}
+
+func (pg *Postgres) UpdateJobProgress(jobId, progress, total int) error {
+	return pg.Exec(`
+		UPDATE jobs SET status=$1,progress=$2,total=$3,updated_at=$4 WHERE id=$5
+	`, models.JobRunning, progress, total, time.Now(), jobId)
+}
+
+func (pg *Postgres) FinishJob(jobId int, filePath string, expiresAt time.Time) error {
+	return pg.Exec(`
+		UPDATE jobs SET status=$1,progress=total,file_path=$2,expires_at=$3,updated_at=$4 WHERE id=$5
+	`, models.JobDone, filePath, expiresAt, time.Now(), jobId)
+}
+
+// for jobs without an archive - the summary is kept until expiresAt
+func (pg *Postgres) FinishJobResult(jobId int, result any, expiresAt time.Time) error {
+	rb, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job result: %v", err)
+	}
+
+	return pg.Exec(`
+		UPDATE jobs SET status=$1,progress=total,result=$2,expires_at=$3,updated_at=$4 WHERE id=$5
+	`, models.JobDone, string(rb), expiresAt, time.Now(), jobId)
+}
+
+func (pg *Postgres) FailJob(jobId int, jobErr error) error {
+	return pg.Exec(`
+		UPDATE jobs SET status=$1,error=$2,updated_at=$3 WHERE id=$4
+	`, models.JobFailed, jobErr.Error(), time.Now(), jobId)
+}
+
+// for cleanup - finished jobs past their expiry and failed jobs older than a day
+func (pg *Postgres) GetExpiredJobs() ([]models.Job, error) {
+	now := time.Now()
+
+	rows, err := pg.conn.Query(`
+		SELECT id,username,kind,status,file_path FROM jobs
+		WHERE expires_at < $1 OR (status=$2 AND updated_at < $3)
+	`, now, models.JobFailed, now.Add(-24*time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		var job models.Job
+		var filePath sql.NullString
+
+		if err := rows.Scan(&job.ID, &job.Username, &job.Kind, &job.Status, &filePath); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		job.FilePath = filePath.String
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+func (pg *Postgres) DeleteJob(jobId int) error {
+	return pg.Exec(`DELETE FROM jobs WHERE id=$1`, jobId)
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+)
+
+// condition on the files row f: the user given by param owns it or it's in an
+// album the user owns or is a member of
+func visibleTo(f, param string) string {
+	return fmt.Sprintf(`(%[1]s.username=%[2]s OR EXISTS (
+		SELECT 1 FROM album_files AS vaf
+		JOIN albums AS va ON va.id=vaf.album_id
+		LEFT JOIN album_members AS vam ON vam.album_id=va.id AND vam.username=%[2]s
+		WHERE vaf.file_id=%[1]s.id AND (va.username=%[2]s OR vam.username IS NOT NULL)
+	))`, f, param)
+}
+
+// like visibleTo, only owners of the file and owners or editors of an album
+// holding it may change it
+func editableBy(f, param string) string {
+	return fmt.Sprintf(`(%[1]s.username=%[2]s OR EXISTS (
+		SELECT 1 FROM album_files AS eaf
+		JOIN albums AS ea ON ea.id=eaf.album_id
+		LEFT JOIN album_members AS eam ON eam.album_id=ea.id AND eam.username=%[2]s AND eam.role='%[3]s'
+		WHERE eaf.file_id=%[1]s.id AND (ea.username=%[2]s OR eam.username IS NOT NULL)
+	))`, f, param, models.RoleEditor)
+}
+
+// owner, a member role, or empty when the user has no access to the album
+func (pg *Postgres) AlbumRole(username, albumId string) (string, error) {
+	var role sql.NullString
+
+	err := pg.conn.QueryRow(`
+		SELECT CASE WHEN a.username=$2 THEN 'owner' ELSE m.role END
+		FROM albums AS a
+		LEFT JOIN album_members AS m ON m.album_id=a.id AND m.username=$2
+		WHERE a.id=$1
+	`, albumId, username).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get role in album %s: %v", albumId, err)
+	}
+
+	return role.String, nil
+}
+
+func (pg *Postgres) GetAlbumMembers(albumId string) ([]models.AlbumMember, error) {
+	rows, err := pg.conn.Query(`
+		SELECT username,role,added_at FROM album_members WHERE album_id=$1 ORDER BY added_at
+	`, albumId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of album %s: %v", albumId, err)
+	}
+	defer rows.Close()
+
+	members := []models.AlbumMember{}
+	for rows.Next() {
+		var m models.AlbumMember
+		if err := rows.Scan(&m.Username, &m.Role, &m.AddedAt); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		members = append(members, m)
+	}
+
+	return members, nil
+}
+
+// owner and members, whose galleries show the album's files
+func (pg *Postgres) GetAlbumAudience(albumId string) ([]string, error) {
+	rows, err := pg.conn.Query(`
+		SELECT username FROM albums WHERE id=$1
+		UNION
+		SELECT username FROM album_members WHERE album_id=$1
+	`, albumId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audience of album %s: %v", albumId, err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// owner of the file and everyone seeing it through an album
+func (pg *Postgres) GetFileAudience(fileId int) ([]string, error) {
+	rows, err := pg.conn.Query(`
+		SELECT username FROM files WHERE id=$1
+		UNION
+		SELECT a.username FROM album_files AS af JOIN albums AS a ON a.id=af.album_id WHERE af.file_id=$1
+		UNION
+		SELECT m.username FROM album_files AS af JOIN album_members AS m ON m.album_id=af.album_id WHERE af.file_id=$1
+	`, fileId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audience of file %d: %v", fileId, err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// invites or changes the role of a member, only the owner can. false when
+// the album isn't the owner's or the member is the owner
+func (pg *Postgres) SetAlbumMember(owner, albumId, username, role string) (bool, error) {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(txctx, `
+		INSERT INTO album_members(album_id,username,role)
+		SELECT id,$2,$3 FROM albums WHERE id=$1 AND username=$4 AND username<>$2
+		ON CONFLICT (album_id,username) DO UPDATE SET role=EXCLUDED.role
+		RETURNING album_id
+	`, albumId, username, role, owner).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to set member %s of album %s: %v", username, albumId, err)
+	}
+
+	if err := recordChange(txctx, tx, models.Change{Username: owner, Kind: models.ChangeAlbumUpdate, AlbumID: id}); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return true, nil
+}
+
+// the owner removes anyone, members can leave
+func (pg *Postgres) RemoveAlbumMember(actor, albumId, username string) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	var owner string
+	err = tx.QueryRowContext(txctx, `
+		DELETE FROM album_members AS m USING albums AS a
+		WHERE a.id=m.album_id AND m.album_id=$1 AND m.username=$2 AND ($3=$2 OR a.username=$3)
+		RETURNING a.id,a.username
+	`, albumId, username, actor).Scan(&id, &owner)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove member %s of album %s: %v", username, albumId, err)
+	}
+
+	if err := recordChange(txctx, tx, models.Change{Username: owner, Kind: models.ChangeAlbumUpdate, AlbumID: id}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"fmt"
+	"kmem/internal/models"
+	"log"
+)
+
+// gallery files with a known capture time, oldest first
+func (pg *Postgres) GetMoments(username string) ([]models.Moment, error) {
+	whereClause, args := galleryWhere(username, models.FileFilter{}, false)
+
+	rows, err := pg.conn.Query(fmt.Sprintf(`
+		SELECT files.id,files.taken_at,COALESCE(m.country,''),COALESCE(m.region,''),COALESCE(m.city,'')
+		FROM files
+		LEFT JOIN file_metadata AS m ON m.file_id=files.id
+		%s AND files.taken_at IS NOT NULL
+		ORDER BY files.taken_at,files.id
+	`, whereClause), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get capture times for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	var moments []models.Moment
+	for rows.Next() {
+		var m models.Moment
+		if err := rows.Scan(&m.FileID, &m.TakenAt, &m.Country, &m.Region, &m.City); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		moments = append(moments, m)
+	}
+
+	return moments, nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+	"time"
+	"unicode/utf8"
+)
+
+// cuts s to the column's VARCHAR(n), counted in characters like postgres does
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
+
+// capture time goes to files (sorting & ranges), the rest to file_metadata
+func (pg *Postgres) UpsertFileMetadata(meta models.FileMetadata) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	// a capture time set by an importer (sidecar) wins over the extracted one
+	if meta.TakenAt != nil {
+		_, err = tx.ExecContext(txctx, `UPDATE files SET taken_at=COALESCE(taken_at,$1) WHERE id=$2`, *meta.TakenAt, meta.FileID)
+		if err != nil {
+			return fmt.Errorf("failed to update capture time: %d: %v", meta.FileID, err)
+		}
+	}
+
+	_, err = tx.ExecContext(txctx, `
+		INSERT INTO file_metadata(file_id,width,height,camera_make,camera_model,orientation,latitude,longitude,duration,title,artist,album)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+		ON CONFLICT (file_id) DO UPDATE SET
+			width=EXCLUDED.width,
+			height=EXCLUDED.height,
+			camera_make=EXCLUDED.camera_make,
+			camera_model=EXCLUDED.camera_model,
+			orientation=EXCLUDED.orientation,
+			latitude=COALESCE(EXCLUDED.latitude,file_metadata.latitude),
+			longitude=COALESCE(EXCLUDED.longitude,file_metadata.longitude),
+			duration=EXCLUDED.duration,
+			title=EXCLUDED.title,
+			artist=EXCLUDED.artist,
+			album=EXCLUDED.album
+	`, meta.FileID, meta.Width, meta.Height, truncate(meta.CameraMake, 64), truncate(meta.CameraModel, 64), meta.Orientation,
+		meta.Latitude, meta.Longitude, meta.Duration, truncate(meta.Title, 255), truncate(meta.Artist, 255), truncate(meta.Album, 255))
+	if err != nil {
+		return fmt.Errorf("failed to upsert metadata: %d: %v", meta.FileID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+func (pg *Postgres) SetTakenAt(fileId int, takenAt time.Time) error {
+	return pg.Exec(`UPDATE files SET taken_at=$1 WHERE id=$2`, takenAt, fileId)
+}
+
+// only fills the location, the rest is left to metadata extraction.
+// the place is looked up again
+func (pg *Postgres) SetLocation(fileId int, lat, lon float64) error {
+	return pg.Exec(`
+		INSERT INTO file_metadata(file_id,latitude,longitude) VALUES($1,$2,$3)
+		ON CONFLICT (file_id) DO UPDATE
+		SET latitude=EXCLUDED.latitude,longitude=EXCLUDED.longitude,country=NULL,region=NULL,city=NULL
+	`, fileId, lat, lon)
+}
+
+// coordinates of a file, false when it has none
+func (pg *Postgres) GetLocation(fileId int) (models.Located, bool, error) {
+	loc := models.Located{FileID: fileId}
+
+	err := pg.conn.QueryRow(`
+		SELECT latitude,longitude FROM file_metadata
+		WHERE file_id=$1 AND latitude IS NOT NULL AND longitude IS NOT NULL
+	`, fileId).Scan(&loc.Latitude, &loc.Longitude)
+	if err == sql.ErrNoRows {
+		return loc, false, nil
+	}
+	if err != nil {
+		return loc, false, fmt.Errorf("failed to get location of %d: %v", fileId, err)
+	}
+
+	return loc, true, nil
+}
+
+// files with coordinates but no place looked up yet, of every user
+func (pg *Postgres) GetUnplacedFiles() ([]models.Located, error) {
+	rows, err := pg.conn.Query(`
+		SELECT file_id,latitude,longitude FROM file_metadata
+		WHERE latitude IS NOT NULL AND longitude IS NOT NULL AND country IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unplaced files: %v", err)
+	}
+	defer rows.Close()
+
+	var locs []models.Located
+	for rows.Next() {
+		var loc models.Located
+		if err := rows.Scan(&loc.FileID, &loc.Latitude, &loc.Longitude); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		locs = append(locs, loc)
+	}
+
+	return locs, nil
+}
+
+// an empty place marks coordinates no city is close to
+func (pg *Postgres) SetPlace(fileId int, place models.Place) error {
+	err := pg.Exec(`UPDATE file_metadata SET country=$1,region=$2,city=$3 WHERE file_id=$4`,
+		truncate(place.Country, 64), truncate(place.Region, 128), truncate(place.City, 128), fileId)
+	if err != nil {
+		return fmt.Errorf("failed to set place of %d: %v", fileId, err)
+	}
+
+	return nil
+}
+
+// file id -> metadata, for exports
+func (pg *Postgres) GetFileMetadataMap(username string) (map[int]models.FileMetadata, error) {
+	rows, err := pg.conn.Query(`
+		SELECT m.file_id,f.taken_at,m.width,m.height,m.camera_make,m.camera_model,m.orientation,m.latitude,m.longitude,m.duration,
+			COALESCE(m.country,''),COALESCE(m.region,''),COALESCE(m.city,''),
+			COALESCE(m.title,''),COALESCE(m.artist,''),COALESCE(m.album,'')
+		FROM file_metadata AS m
+		JOIN files AS f ON f.id=m.file_id
+		WHERE f.username=$1
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	mmap := make(map[int]models.FileMetadata)
+	for rows.Next() {
+		meta, err := scanFileMetadata(rows)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		mmap[meta.FileID] = meta
+	}
+
+	return mmap, nil
+}
+
+// columns as selected by GetFileMetadataMap
+func scanFileMetadata(rows *sql.Rows) (models.FileMetadata, error) {
+	var meta models.FileMetadata
+	var width, height, orientation sql.NullInt64
+	var cameraMake, cameraModel sql.NullString
+	var duration sql.NullFloat64
+
+	err := rows.Scan(&meta.FileID, &meta.TakenAt, &width, &height, &cameraMake, &cameraModel, &orientation,
+		&meta.Latitude, &meta.Longitude, &duration, &meta.Country, &meta.Region, &meta.City,
+		&meta.Title, &meta.Artist, &meta.Album)
+	if err != nil {
+		return meta, err
+	}
+
+	meta.Width = int(width.Int64)
+	meta.Height = int(height.Int64)
+	meta.CameraMake = cameraMake.String
+	meta.CameraModel = cameraModel.String
+	meta.Orientation = int(orientation.Int64)
+	meta.Duration = duration.Float64
+
+	return meta, nil
+}
@@ -54,6 +54,8 @@ func (pg *Postgres) initTables() error {
 		file_size BIGINT,
 		mime_type VARCHAR(32),
 		uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		taken_at TIMESTAMP,
+		caption TEXT,
 		deleted BOOL DEFAULT false,
 		deleted_at TIMESTAMP,
 		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
@@ -72,13 +74,331 @@ func (pg *Postgres) initTables() error {
 		relative_path VARCHAR(255) NOT NULL,
 		file_size BIGINT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(file_id,size_name),
 		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
 	)`)
 	if err != nil {
 		return fmt.Errorf("failed to init thumbnails table: %v", err)
 	}
 
+	// a thumbnail size can come in several formats now
+	err = pg.Exec(`ALTER TABLE thumbnails
+		ADD COLUMN IF NOT EXISTS format VARCHAR(10) NOT NULL DEFAULT '',
+		DROP CONSTRAINT IF EXISTS thumbnails_file_id_size_name_key`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate thumbnails table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS thumbnails_file_size_format_idx ON thumbnails(file_id,size_name,format)`)
+	if err != nil {
+		return fmt.Errorf("failed to init thumbnails index: %v", err)
+	}
+
+	// columns added after the first release
+	err = pg.Exec(`ALTER TABLE files
+		ADD COLUMN IF NOT EXISTS taken_at TIMESTAMP,
+		ADD COLUMN IF NOT EXISTS caption TEXT`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate files table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS file_metadata(
+		file_id INTEGER PRIMARY KEY,
+		width INTEGER,
+		height INTEGER,
+		camera_make VARCHAR(64),
+		camera_model VARCHAR(64),
+		orientation INTEGER,
+		latitude DOUBLE PRECISION,
+		longitude DOUBLE PRECISION,
+		duration DOUBLE PRECISION,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init file_metadata table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS albums(
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(20) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init albums table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS album_files(
+		album_id INTEGER NOT NULL,
+		file_id INTEGER NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (album_id,file_id),
+		FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init album_files table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS tags(
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(20) NOT NULL,
+		name VARCHAR(64) NOT NULL,
+		UNIQUE(username,name),
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init tags table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS file_tags(
+		file_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (file_id,tag_id),
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init file_tags table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS jobs(
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(20) NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		status VARCHAR(10) NOT NULL,
+		progress INTEGER DEFAULT 0,
+		total INTEGER DEFAULT 0,
+		file_path VARCHAR(255),
+		error TEXT,
+		result TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init jobs table: %v", err)
+	}
+
+	// no foreign keys on file & album - entries outlive purged rows.
+	// every transaction that could still commit a lower id was running when
+	// the entry was written, so it has an xid below snapshot_xmax
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS changes(
+		id BIGSERIAL PRIMARY KEY,
+		username VARCHAR(20) NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		file_id INTEGER,
+		album_id INTEGER,
+		snapshot_xmax BIGINT NOT NULL DEFAULT pg_snapshot_xmax(pg_current_snapshot())::text::BIGINT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init changes table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE INDEX IF NOT EXISTS changes_username_id_idx ON changes(username,id)`)
+	if err != nil {
+		return fmt.Errorf("failed to init changes index: %v", err)
+	}
+
+	// highest change id removed by compaction, older sync tokens must resync
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS sync_state(
+		id INTEGER PRIMARY KEY CHECK (id=1),
+		compacted_id BIGINT NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init sync_state table: %v", err)
+	}
+
+	// one row per hls variant, the master playlist sits next to the variant dirs
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS video_renditions(
+		id SERIAL PRIMARY KEY,
+		file_id INTEGER NOT NULL,
+		name VARCHAR(10) NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		bandwidth INTEGER NOT NULL,
+		dir_path TEXT NOT NULL,
+		relative_path TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(file_id,name),
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init video_renditions table: %v", err)
+	}
+
+	// edit stack as json, the original file is never touched
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS file_edits(
+		file_id INTEGER PRIMARY KEY,
+		ops JSONB NOT NULL DEFAULT '[]',
+		version INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init file_edits table: %v", err)
+	}
+
+	// perceptual hashes of the medium thumbnail, see media.DHash & media.PHash
+	// paired is cleared on every rehash, set once the file's pairs are stored
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS file_hashes(
+		file_id INTEGER PRIMARY KEY,
+		dhash BIGINT NOT NULL,
+		phash BIGINT NOT NULL,
+		paired BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init file_hashes table: %v", err)
+	}
+
+	// near duplicates up to utils.MAX_DUPLICATE_DISTANCE, see dedupe.Pairs
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS duplicate_pairs(
+		file_a INTEGER NOT NULL,
+		file_b INTEGER NOT NULL,
+		distance SMALLINT NOT NULL,
+		PRIMARY KEY (file_a,file_b),
+		FOREIGN KEY (file_a) REFERENCES files(id) ON DELETE CASCADE,
+		FOREIGN KEY (file_b) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init duplicate_pairs table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE INDEX IF NOT EXISTS duplicate_pairs_file_b_idx ON duplicate_pairs(file_b)`)
+	if err != nil {
+		return fmt.Errorf("failed to init duplicate_pairs index: %v", err)
+	}
+
+	// a file is in one stack at most
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS stacks(
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(20) NOT NULL,
+		kind VARCHAR(10) NOT NULL,
+		primary_file_id INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+		FOREIGN KEY (primary_file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init stacks table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS stack_files(
+		stack_id INTEGER NOT NULL,
+		file_id INTEGER NOT NULL UNIQUE,
+		PRIMARY KEY (stack_id,file_id),
+		FOREIGN KEY (stack_id) REFERENCES stacks(id) ON DELETE CASCADE,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init stack_files table: %v", err)
+	}
+
+	// files the user took out of a stack, auto stacking leaves them alone
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS stack_ignores(
+		file_id INTEGER PRIMARY KEY,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init stack_ignores table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE INDEX IF NOT EXISTS stacks_primary_idx ON stacks(primary_file_id)`)
+	if err != nil {
+		return fmt.Errorf("failed to init stacks index: %v", err)
+	}
+
+	// auto stacking looks for files shot around the same time
+	err = pg.Exec(`CREATE INDEX IF NOT EXISTS files_username_taken_at_idx ON files(username,taken_at)`)
+	if err != nil {
+		return fmt.Errorf("failed to init files capture time index: %v", err)
+	}
+
+	// smart albums keep a filter instead of files
+	err = pg.Exec(`ALTER TABLE albums ADD COLUMN IF NOT EXISTS query JSONB`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate albums table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS album_members(
+		album_id INTEGER NOT NULL,
+		username VARCHAR(20) NOT NULL,
+		role VARCHAR(16) NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (album_id,username),
+		FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init album_members table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE INDEX IF NOT EXISTS album_members_username_idx ON album_members(username)`)
+	if err != nil {
+		return fmt.Errorf("failed to init album_members index: %v", err)
+	}
+
+	// places reverse geocoded from the coordinates, NULL until looked up
+	err = pg.Exec(`ALTER TABLE file_metadata
+		ADD COLUMN IF NOT EXISTS country VARCHAR(64),
+		ADD COLUMN IF NOT EXISTS region VARCHAR(128),
+		ADD COLUMN IF NOT EXISTS city VARCHAR(128)`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate file_metadata table: %v", err)
+	}
+
+	// map bounding box queries
+	err = pg.Exec(`CREATE INDEX IF NOT EXISTS file_metadata_location_idx ON file_metadata(latitude,longitude) WHERE latitude IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to init file_metadata location index: %v", err)
+	}
+
+	err = pg.Exec(`CREATE TABLE IF NOT EXISTS folders(
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(20) NOT NULL,
+		parent_id INTEGER,
+		name VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE,
+		FOREIGN KEY (parent_id) REFERENCES folders(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to init folders table: %v", err)
+	}
+
+	// names are unique among siblings, the root has no parent row
+	err = pg.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS folders_name_idx ON folders(username,COALESCE(parent_id,0),name)`)
+	if err != nil {
+		return fmt.Errorf("failed to init folders index: %v", err)
+	}
+
+	// general files carry longer types (office documents), files of a deleted folder go to the root
+	err = pg.Exec(`ALTER TABLE files
+		ALTER COLUMN mime_type TYPE VARCHAR(128),
+		ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate files table: %v", err)
+	}
+
+	err = pg.Exec(`CREATE INDEX IF NOT EXISTS files_folder_idx ON files(username,folder_id)`)
+	if err != nil {
+		return fmt.Errorf("failed to init files folder index: %v", err)
+	}
+
+	// id3 / vorbis tags of audio files
+	err = pg.Exec(`ALTER TABLE file_metadata
+		ADD COLUMN IF NOT EXISTS title VARCHAR(255),
+		ADD COLUMN IF NOT EXISTS artist VARCHAR(255),
+		ADD COLUMN IF NOT EXISTS album VARCHAR(255)`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate file_metadata table: %v", err)
+	}
+
 	// TODO: add index
 
 	return nil
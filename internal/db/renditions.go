@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+	"path"
+	"path/filepath"
+
+	"github.com/lib/pq"
+)
+
+// swaps every rendition of a file, used after a (re)transcode
+func (pg *Postgres) ReplaceRenditions(fileId int, renditions []models.Rendition) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(txctx, `DELETE FROM video_renditions WHERE file_id=$1`, fileId); err != nil {
+		return fmt.Errorf("failed to clear renditions of %d: %v", fileId, err)
+	}
+
+	for _, r := range renditions {
+		_, err := tx.ExecContext(txctx, `
+			INSERT INTO video_renditions(file_id,name,width,height,bandwidth,dir_path,relative_path)
+			VALUES($1,$2,$3,$4,$5,$6,$7)
+		`, fileId, r.Name, r.Width, r.Height, r.Bandwidth, r.DirPath, r.RelativePath)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s rendition of %d: %v", r.Name, fileId, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+// file id -> directory holding all renditions of the file
+func (pg *Postgres) GetRenditionDirs() (map[int]string, error) {
+	rows, err := pg.conn.Query(`SELECT DISTINCT file_id,dir_path FROM video_renditions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rendition dirs: %v", err)
+	}
+	defer rows.Close()
+
+	dirs := make(map[int]string)
+	for rows.Next() {
+		var fileId int
+		var dir string
+
+		if err := rows.Scan(&fileId, &dir); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		dirs[fileId] = filepath.Dir(dir)
+	}
+
+	return dirs, nil
+}
+
+// directory holding all renditions of a file, empty when it has none
+func (pg *Postgres) GetRenditionDir(fileId int) (string, error) {
+	var dir string
+
+	err := pg.conn.QueryRow(`SELECT dir_path FROM video_renditions WHERE file_id=$1 LIMIT 1`, fileId).Scan(&dir)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get rendition dir of %d: %v", fileId, err)
+	}
+
+	return filepath.Dir(dir), nil
+}
+
+// fills Stream and Renditions of the given files
+func (pg *Postgres) withRenditions(files []models.FileResponse) ([]models.FileResponse, error) {
+	if len(files) == 0 {
+		return files, nil
+	}
+
+	ids := make([]int64, len(files))
+	index := make(map[int]int, len(files))
+	for i, f := range files {
+		ids[i] = int64(f.ID)
+		index[f.ID] = i
+	}
+
+	rows, err := pg.conn.Query(`
+		SELECT file_id,name,width,height,relative_path FROM video_renditions
+		WHERE file_id = ANY($1)
+		ORDER BY file_id,height
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get renditions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fileId int
+		var r models.RenditionResponse
+
+		if err := rows.Scan(&fileId, &r.Name, &r.Width, &r.Height, &r.FilePath); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		f := &files[index[fileId]]
+		f.Renditions = append(f.Renditions, r)
+		// <renditions dir>/<name>/index.m3u8 -> <renditions dir>/master.m3u8
+		f.Stream = path.Join(path.Dir(path.Dir(r.FilePath)), "master.m3u8")
+	}
+
+	return files, nil
+}
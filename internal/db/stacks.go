@@ -0,0 +1,382 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func toInt64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+
+	return out
+}
+
+// moves the user's files among ids into the stack, out of any other stack
+func moveToStack(ctx context.Context, tx *sql.Tx, username string, stackId int, ids []int) (int64, error) {
+	owned := `SELECT id FROM files WHERE id=ANY($1) AND username=$2 AND deleted=false`
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM stack_files WHERE file_id IN (`+owned+`)`, pq.Array(toInt64s(ids)), username); err != nil {
+		return 0, fmt.Errorf("failed to unstack files: %v", err)
+	}
+
+	// stacking a file again undoes taking it out
+	if _, err := tx.ExecContext(ctx, `DELETE FROM stack_ignores WHERE file_id IN (`+owned+`)`, pq.Array(toInt64s(ids)), username); err != nil {
+		return 0, fmt.Errorf("failed to clear stack ignores: %v", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO stack_files(stack_id,file_id) SELECT $3,id FROM (`+owned+`) AS f`,
+		pq.Array(toInt64s(ids)), username, stackId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stack files: %v", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// stacks whose primary left get the earliest member instead, stacks
+// of fewer than two files are dissolved
+func pruneStacks(ctx context.Context, tx *sql.Tx, username string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE stacks AS s SET primary_file_id=(
+			SELECT sf.file_id FROM stack_files AS sf
+			JOIN files AS f ON f.id=sf.file_id
+			WHERE sf.stack_id=s.id
+			ORDER BY COALESCE(f.taken_at,f.uploaded_at),f.id
+			LIMIT 1
+		)
+		WHERE s.username=$1
+		AND NOT EXISTS (SELECT 1 FROM stack_files AS sf WHERE sf.stack_id=s.id AND sf.file_id=s.primary_file_id)
+		AND EXISTS (SELECT 1 FROM stack_files AS sf WHERE sf.stack_id=s.id)
+	`, username)
+	if err != nil {
+		return fmt.Errorf("failed to fix stack primaries: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM stacks AS s
+		WHERE s.username=$1 AND (SELECT COUNT(*) FROM stack_files AS sf WHERE sf.stack_id=s.id) < 2
+	`, username)
+	if err != nil {
+		return fmt.Errorf("failed to remove small stacks: %v", err)
+	}
+
+	return nil
+}
+
+// stacks the user's files among fileIds, the primary is added when missing
+func (pg *Postgres) CreateStack(username, kind string, primary int, fileIds []int) (int, error) {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(txctx, `
+		INSERT INTO stacks(username,kind,primary_file_id)
+		SELECT $1,$2,id FROM files WHERE id=$3 AND username=$1 AND deleted=false
+		RETURNING id
+	`, username, kind, primary).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create stack of %d: %v", primary, err)
+	}
+
+	n, err := moveToStack(txctx, tx, username, id, append(fileIds, primary))
+	if err != nil {
+		return 0, err
+	}
+	if n < 2 {
+		return 0, fmt.Errorf("a stack needs at least two files")
+	}
+
+	if err := pruneStacks(txctx, tx, username); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return id, nil
+}
+
+func (pg *Postgres) AddStackFiles(username, stackId string, fileIds []int) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(txctx, `SELECT id FROM stacks WHERE id=$1 AND username=$2`, stackId, username).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("stack not found: %s", stackId)
+	}
+
+	if _, err := moveToStack(txctx, tx, username, id, fileIds); err != nil {
+		return err
+	}
+
+	if err := pruneStacks(txctx, tx, username); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+// takes a file out of its stack for good, auto stacking won't put it back
+func (pg *Postgres) RemoveStackFile(username, stackId, fileId string) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	var fid int
+	err = tx.QueryRowContext(txctx, `
+		DELETE FROM stack_files AS sf USING stacks AS s
+		WHERE s.id=sf.stack_id AND s.id=$1 AND s.username=$2 AND sf.file_id=$3
+		RETURNING sf.file_id
+	`, stackId, username, fileId).Scan(&fid)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove file %s from stack %s: %v", fileId, stackId, err)
+	}
+
+	if _, err := tx.ExecContext(txctx, `INSERT INTO stack_ignores(file_id) VALUES($1) ON CONFLICT DO NOTHING`, fid); err != nil {
+		return fmt.Errorf("failed to ignore file %d: %v", fid, err)
+	}
+
+	if err := pruneStacks(txctx, tx, username); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+func (pg *Postgres) SetStackPrimary(username, stackId string, fileId int) error {
+	err := pg.Exec(`
+		UPDATE stacks SET primary_file_id=$1
+		WHERE id=$2 AND username=$3
+		AND EXISTS (SELECT 1 FROM stack_files WHERE stack_id=$2 AND file_id=$1)
+	`, fileId, stackId, username)
+	if err != nil {
+		return fmt.Errorf("failed to set primary of stack %s: %v", stackId, err)
+	}
+
+	return nil
+}
+
+// unstacks every member, like removing them one by one
+func (pg *Postgres) DeleteStack(username, stackId string) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(txctx, `
+		INSERT INTO stack_ignores(file_id)
+		SELECT sf.file_id FROM stack_files AS sf
+		JOIN stacks AS s ON s.id=sf.stack_id
+		WHERE s.id=$1 AND s.username=$2
+		ON CONFLICT DO NOTHING
+	`, stackId, username)
+	if err != nil {
+		return fmt.Errorf("failed to ignore files of stack %s: %v", stackId, err)
+	}
+
+	if _, err := tx.ExecContext(txctx, `DELETE FROM stacks WHERE id=$1 AND username=$2`, stackId, username); err != nil {
+		return fmt.Errorf("failed to delete stack %s: %v", stackId, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+// members of a stack, primary first then by capture time
+func (pg *Postgres) GetStackFiles(username, stackId string) ([]models.FileResponse, error) {
+	rows, err := pg.conn.Query(`
+		SELECT f.id,f.original_name,f.relative_path,f.mime_type,f.username,t.size_name,t.relative_path,t.width,t.height,t.format FROM (
+			SELECT f.id,f.original_name,f.relative_path,f.mime_type,f.username,
+				f.id=s.primary_file_id AS is_primary,COALESCE(f.taken_at,f.uploaded_at) AS captured
+			FROM files AS f
+			JOIN stack_files AS sf ON sf.file_id=f.id
+			JOIN stacks AS s ON s.id=sf.stack_id
+			WHERE s.id=$1 AND s.username=$2 AND f.deleted=false
+		) AS f
+		LEFT JOIN thumbnails AS t ON f.id=t.file_id
+		ORDER BY f.is_primary DESC,f.captured,f.id
+	`, stackId, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files of stack %s: %v", stackId, err)
+	}
+	defer rows.Close()
+
+	return pg.withRenditions(scanFileResponses(rows))
+}
+
+// fills Stack of the files that are the primary of a stack
+func (pg *Postgres) withStacks(files []models.FileResponse) ([]models.FileResponse, error) {
+	if len(files) == 0 {
+		return files, nil
+	}
+
+	ids := make([]int, len(files))
+	index := make(map[int]int, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+		index[f.ID] = i
+	}
+
+	rows, err := pg.conn.Query(`
+		SELECT s.primary_file_id,s.id,s.kind,COUNT(*) FROM stacks AS s
+		JOIN stack_files AS sf ON sf.stack_id=s.id
+		JOIN files AS f ON f.id=sf.file_id AND f.deleted=false
+		WHERE s.primary_file_id=ANY($1)
+		GROUP BY s.id
+	`, pq.Array(toInt64s(ids)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stacks: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fileId int
+		var st models.StackResponse
+
+		if err := rows.Scan(&fileId, &st.ID, &st.Kind, &st.Count); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		// a lone primary left after trashing the rest is just a file
+		if st.Count > 1 {
+			files[index[fileId]].Stack = &st
+		}
+	}
+
+	return files, nil
+}
+
+func scanStackCandidates(rows *sql.Rows) []models.StackCandidate {
+	var cands []models.StackCandidate
+	for rows.Next() {
+		var c models.StackCandidate
+		var camera, kind sql.NullString
+		var stackId sql.NullInt64
+
+		if err := rows.Scan(&c.ID, &c.OriginalName, &c.MimeType, &c.TakenAt, &camera, &stackId, &kind); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		c.CameraModel = camera.String
+		c.StackID = int(stackId.Int64)
+		c.StackKind = kind.String
+		cands = append(cands, c)
+	}
+
+	return cands
+}
+
+const stackCandidateQuery = `
+	SELECT f.id,f.original_name,f.mime_type,f.taken_at,m.camera_model,s.id,s.kind
+	FROM files AS f
+	LEFT JOIN file_metadata AS m ON m.file_id=f.id
+	LEFT JOIN stack_files AS sf ON sf.file_id=f.id
+	LEFT JOIN stacks AS s ON s.id=sf.stack_id
+	WHERE f.deleted=false AND f.taken_at IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM stack_ignores WHERE file_id=f.id)
+`
+
+// files without a capture time or taken out of stacks by the user aren't candidates
+func (pg *Postgres) GetStackCandidate(fileId int) (models.StackCandidate, bool, error) {
+	rows, err := pg.conn.Query(stackCandidateQuery+` AND f.id=$1`, fileId)
+	if err != nil {
+		return models.StackCandidate{}, false, fmt.Errorf("failed to get stack candidate %d: %v", fileId, err)
+	}
+	defer rows.Close()
+
+	cands := scanStackCandidates(rows)
+	if len(cands) == 0 {
+		return models.StackCandidate{}, false, nil
+	}
+
+	return cands[0], true, nil
+}
+
+// candidates of the user shot between from and to, by capture time
+func (pg *Postgres) GetStackCandidatesBetween(username string, from, to time.Time) ([]models.StackCandidate, error) {
+	rows, err := pg.conn.Query(stackCandidateQuery+`
+		AND f.username=$1 AND f.taken_at BETWEEN $2 AND $3
+		ORDER BY f.taken_at,f.id
+	`, username, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stack candidates: %v", err)
+	}
+	defer rows.Close()
+
+	return scanStackCandidates(rows), nil
+}
+
+// files of the user with a capture time that aren't stacked yet, oldest first
+func (pg *Postgres) GetUnstackedFileIds(username string) ([]int, error) {
+	rows, err := pg.conn.Query(`
+		SELECT f.id FROM files AS f
+		WHERE f.username=$1 AND f.deleted=false AND f.taken_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM stack_files WHERE file_id=f.id)
+		AND NOT EXISTS (SELECT 1 FROM stack_ignores WHERE file_id=f.id)
+		ORDER BY f.taken_at
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unstacked files: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Println(err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
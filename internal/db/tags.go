@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"kmem/internal/models"
+	"log"
+)
+
+func (pg *Postgres) GetTags(username string) ([]models.Tag, error) {
+	rows, err := pg.conn.Query(`
+		SELECT t.id,t.username,t.name,COUNT(f.id)
+		FROM tags AS t
+		LEFT JOIN file_tags AS ft ON t.id=ft.tag_id
+		LEFT JOIN files AS f ON ft.file_id=f.id AND f.deleted=false
+		WHERE t.username=$1
+		GROUP BY t.id
+		ORDER BY t.name ASC
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Username, &tag.Name, &tag.FileCount); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// replaces the whole tag set of a file, unknown tags are created
+func (pg *Postgres) SetFileTags(username, fileId string, tags []string) error {
+	txctx, cancel := context.WithTimeout(pg.ctx, pg.txtimeout)
+	defer cancel()
+
+	tx, err := pg.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	var owner string
+	err = tx.QueryRowContext(txctx, `SELECT id,username FROM files WHERE id=$1 AND deleted=false`, fileId).Scan(&id, &owner)
+	if err != nil || owner != username {
+		return fmt.Errorf("file not found: %s", fileId)
+	}
+
+	if _, err := tx.ExecContext(txctx, `DELETE FROM file_tags WHERE file_id=$1`, fileId); err != nil {
+		return fmt.Errorf("failed to clear tags of %s: %v", fileId, err)
+	}
+
+	for _, name := range tags {
+		var tagId int
+		err := tx.QueryRowContext(txctx, `
+			INSERT INTO tags(username,name) VALUES($1,$2)
+			ON CONFLICT (username,name) DO UPDATE SET name=EXCLUDED.name
+			RETURNING id
+		`, username, name).Scan(&tagId)
+		if err != nil {
+			return fmt.Errorf("failed to upsert tag %s: %v", name, err)
+		}
+
+		_, err = tx.ExecContext(txctx, `
+			INSERT INTO file_tags(file_id,tag_id) VALUES($1,$2) ON CONFLICT DO NOTHING
+		`, fileId, tagId)
+		if err != nil {
+			return fmt.Errorf("failed to tag %s with %s: %v", fileId, name, err)
+		}
+	}
+
+	if err := recordChange(txctx, tx, models.Change{Username: username, Kind: models.ChangeFileUpdate, FileID: id}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %v", err)
+	}
+
+	return nil
+}
+
+// file id -> tag names
+func (pg *Postgres) GetFileTagsMap(username string) (map[int][]string, error) {
+	rows, err := pg.conn.Query(`
+		SELECT ft.file_id,t.name FROM file_tags AS ft
+		JOIN tags AS t ON t.id=ft.tag_id
+		WHERE t.username=$1
+		ORDER BY t.name ASC
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file tags for %s: %v", username, err)
+	}
+	defer rows.Close()
+
+	tmap := make(map[int][]string)
+	for rows.Next() {
+		var fileId int
+		var name string
+		if err := rows.Scan(&fileId, &name); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		tmap[fileId] = append(tmap[fileId], name)
+	}
+
+	return tmap, nil
+}
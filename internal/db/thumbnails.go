@@ -5,14 +5,33 @@ import (
 	"kmem/internal/models"
 )
 
+// regenerated thumbnails replace the row, the old file is left to cleanItems
 func (pg *Postgres) InsertThumbnails(t models.Thumbnail) error {
 	err := pg.Exec(`
-		INSERT INTO thumbnails(file_id,size_name,width,height,file_path,relative_path,file_size)
-		VALUES($1,$2,$3,$4,$5,$6,$7)
-		`, t.FileID, t.SizeName, t.Width, t.Height, t.FilePath, t.RelativePath, t.FileSize)
+		INSERT INTO thumbnails(file_id,size_name,format,width,height,file_path,relative_path,file_size)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+		ON CONFLICT (file_id,size_name,format) DO UPDATE
+		SET width=EXCLUDED.width, height=EXCLUDED.height, file_path=EXCLUDED.file_path,
+			relative_path=EXCLUDED.relative_path, file_size=EXCLUDED.file_size, created_at=CURRENT_TIMESTAMP
+		`, t.FileID, t.SizeName, t.Format, t.Width, t.Height, t.FilePath, t.RelativePath, t.FileSize)
 	if err != nil {
 		return fmt.Errorf("failed to insert thumbnail: %v", err)
 	}
 
 	return nil
 }
+
+// the same thumbnail size in another format, for content negotiation
+func (pg *Postgres) QueryThumbnailFormat(fileId int, sizeName, format string) (models.Thumbnail, error) {
+	t := models.Thumbnail{FileID: fileId, SizeName: sizeName, Format: format}
+
+	err := pg.conn.QueryRow(`
+		SELECT id,width,height,file_path,relative_path FROM thumbnails
+		WHERE file_id=$1 AND size_name=$2 AND format=$3
+	`, fileId, sizeName, format).Scan(&t.ID, &t.Width, &t.Height, &t.FilePath, &t.RelativePath)
+	if err != nil {
+		return t, fmt.Errorf("failed to query %s %s thumbnail of %d: %v", format, sizeName, fileId, err)
+	}
+
+	return t, nil
+}
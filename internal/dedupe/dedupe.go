@@ -0,0 +1,116 @@
+package dedupe
+
+import (
+	"kmem/internal/media"
+	"kmem/internal/models"
+	"sort"
+)
+
+// files close enough to be near duplicates at any distance a user can ask
+// for: fresh ones against every file, each pair once. run by the hash job,
+// the pairs are stored so listing duplicates never compares hashes again
+func Pairs(fresh, all []models.DuplicateFile, maxDistance int) []models.DuplicatePair {
+	isFresh := make(map[int]bool, len(fresh))
+	for _, f := range fresh {
+		isFresh[f.ID] = true
+	}
+
+	var pairs []models.DuplicatePair
+	for _, f := range fresh {
+		for _, g := range all {
+			// fresh pairs are seen from both sides, keep one
+			if g.ID == f.ID || (isFresh[g.ID] && g.ID < f.ID) {
+				continue
+			}
+
+			// both hashes have to agree
+			d := max(media.HashDistance(f.PHash, g.PHash), media.HashDistance(f.DHash, g.DHash))
+			if d > maxDistance {
+				continue
+			}
+
+			pairs = append(pairs, models.DuplicatePair{FileA: min(f.ID, g.ID), FileB: max(f.ID, g.ID), Distance: d})
+		}
+	}
+
+	return pairs
+}
+
+// joins files linked by pairs within maxDistance, groups are transitive so
+// a burst ends up as one. pairs of files not in files are ignored
+func Group(files []models.DuplicateFile, pairs []models.DuplicatePair, maxDistance int) []models.DuplicateGroup {
+	index := make(map[int]int, len(files))
+	parent := make([]int, len(files))
+	for i := range files {
+		index[files[i].ID] = i
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for _, p := range pairs {
+		if p.Distance > maxDistance {
+			continue
+		}
+
+		i, ok := index[p.FileA]
+		if !ok {
+			continue
+		}
+		j, ok := index[p.FileB]
+		if !ok {
+			continue
+		}
+
+		if ri, rj := find(i), find(j); ri != rj {
+			parent[rj] = ri
+		}
+	}
+
+	members := make(map[int][]models.DuplicateFile)
+	var roots []int
+	for i := range files {
+		r := find(i)
+		if _, ok := members[r]; !ok {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], files[i])
+	}
+
+	var groups []models.DuplicateGroup
+	for _, r := range roots {
+		if len(members[r]) < 2 {
+			continue
+		}
+
+		groups = append(groups, suggest(members[r]))
+	}
+
+	return groups
+}
+
+// best copy first: most pixels, then earliest capture, then biggest file
+func suggest(files []models.DuplicateFile) models.DuplicateGroup {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if pa, pb := a.Width*a.Height, b.Width*b.Height; pa != pb {
+			return pa > pb
+		}
+		if ca, cb := a.CapturedAt(), b.CapturedAt(); !ca.Equal(cb) {
+			return ca.Before(cb)
+		}
+		return a.FileSize > b.FileSize
+	})
+
+	for i := range files {
+		files[i].Distance = media.HashDistance(files[0].PHash, files[i].PHash)
+	}
+
+	return models.DuplicateGroup{Keep: files[0].ID, Files: files}
+}
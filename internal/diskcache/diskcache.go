@@ -0,0 +1,227 @@
+package diskcache
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tmpPrefix = ".tmp-"
+
+type entry struct {
+	key  string
+	size int64
+}
+
+// one render in progress, waiters block on done
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// bounded on-disk cache of rendered files with lru eviction,
+// concurrent misses for the same key are rendered once
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	ll       *list.List // front is the most recently used
+	entries  map[string]*list.Element
+	size     int64
+	inflight map[string]*call
+}
+
+// picks up whatever an earlier run left in dir, oldest mtime first out
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %v", err)
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*call),
+	}
+
+	type found struct {
+		entry
+		mtime time.Time
+	}
+
+	var existing []found
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// renders interrupted by a restart
+		if strings.HasPrefix(d.Name(), tmpPrefix) {
+			os.Remove(path)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		existing = append(existing, found{entry{d.Name(), info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache dir: %v", err)
+	}
+
+	sort.Slice(existing, func(i, j int) bool { return existing[i].mtime.Before(existing[j].mtime) })
+	for _, f := range existing {
+		c.entries[f.key] = c.ll.PushFront(&f.entry)
+		c.size += f.size
+	}
+	c.evict()
+
+	return c, nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:min(2, len(key))], key)
+}
+
+func validKey(key string) bool {
+	return len(key) > 0 && !strings.ContainsAny(key, `/\`) && !strings.HasPrefix(key, ".")
+}
+
+// opens the cached file for key, rendering it first on a miss
+func (c *Cache) Open(key string, render func(w io.Writer) error) (*os.File, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("invalid cache key: %q", key)
+	}
+
+	for {
+		c.mu.Lock()
+
+		if el, ok := c.entries[key]; ok {
+			c.ll.MoveToFront(el)
+			f, err := os.Open(c.path(key))
+			if err == nil {
+				c.mu.Unlock()
+
+				// keeps the order across restarts
+				now := time.Now()
+				os.Chtimes(f.Name(), now, now)
+
+				return f, nil
+			}
+
+			// removed behind our back, render again
+			c.remove(el)
+		}
+
+		if cl, ok := c.inflight[key]; ok {
+			c.mu.Unlock()
+
+			<-cl.done
+			if cl.err != nil {
+				return nil, cl.err
+			}
+
+			continue
+		}
+
+		cl := &call{done: make(chan struct{})}
+		c.inflight[key] = cl
+		c.mu.Unlock()
+
+		f, err := c.fill(key, render)
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+
+		cl.err = err
+		close(cl.done)
+
+		return f, err
+	}
+}
+
+// renders into a temp file and moves it in place, the returned file stays
+// readable even if it gets evicted right away
+func (c *Cache) fill(key string, render func(w io.Writer) error) (*os.File, error) {
+	dst := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), tmpPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %v", err)
+	}
+
+	if err := render(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to write cache file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to store cache file: %v", err)
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.ll.PushFront(&entry{key, info.Size()})
+	c.size += info.Size()
+	c.evict()
+
+	return f, nil
+}
+
+// callers hold mu
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.ll.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// callers hold mu
+func (c *Cache) evict() {
+	for c.size > c.maxBytes && c.ll.Len() > 0 {
+		el := c.ll.Back()
+		key := el.Value.(*entry).key
+
+		c.remove(el)
+		os.Remove(c.path(key))
+	}
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"kmem/internal/models"
+	"sync"
+)
+
+// events buffered per subscriber, a stream that falls further behind
+// than this starts losing events instead of blocking publishers
+const subBuffer = 64
+
+// in-process pub/sub keyed by username, a nil bus drops everything
+// so one-shot runs like the cli don't need one
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan models.Event]struct{}
+}
+
+func New() *Bus {
+	return &Bus{
+		subs: make(map[string]map[chan models.Event]struct{}),
+	}
+}
+
+// returned func must be called once the subscriber is gone
+func (b *Bus) Subscribe(username string) (<-chan models.Event, func()) {
+	ch := make(chan models.Event, subBuffer)
+
+	b.mu.Lock()
+	if b.subs[username] == nil {
+		b.subs[username] = make(map[chan models.Event]struct{})
+	}
+	b.subs[username][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[username], ch)
+			if len(b.subs[username]) == 0 {
+				delete(b.subs, username)
+			}
+			b.mu.Unlock()
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+func (b *Bus) Publish(username string, kind models.EventKind, data any) {
+	if b == nil {
+		return
+	}
+
+	ev := models.Event{Kind: kind, Data: data}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subs[username] {
+		select {
+		case ch <- ev:
+		default: // slow subscriber
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"kmem/internal/models"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusKm = 6371.0
+
+// any of the geonames city dumps, smallest population threshold first
+var cityFiles = []string{"cities500.txt", "cities1000.txt", "cities5000.txt", "cities15000.txt"}
+
+type city struct {
+	name    string
+	lat     float64
+	lon     float64
+	country string // iso code
+	admin1  string // "<country>.<admin1 code>"
+}
+
+type cell struct {
+	lat, lon int
+}
+
+// offline reverse geocoder over a geonames dump
+// (https://download.geonames.org/export/dump/), cities are bucketed in
+// one degree cells so a lookup only looks at its neighbourhood
+type Geocoder struct {
+	cells     map[cell][]city
+	countries map[string]string // iso code -> name
+	regions   map[string]string // "US.CA" -> name
+	maxKm     float64
+}
+
+// reads a cities dump plus, when present, admin1CodesASCII.txt and
+// countryInfo.txt from dir. without those the codes are used as names
+func Load(dir string, maxKm float64) (*Geocoder, error) {
+	g := &Geocoder{
+		cells:     make(map[cell][]city),
+		countries: make(map[string]string),
+		regions:   make(map[string]string),
+		maxKm:     maxKm,
+	}
+
+	var path string
+	for _, name := range cityFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			path = filepath.Join(dir, name)
+			break
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no geonames cities file in %s", dir)
+	}
+
+	n := 0
+	err := readTsv(path, func(fields []string) {
+		if len(fields) < 11 {
+			return
+		}
+
+		lat, err1 := strconv.ParseFloat(fields[4], 64)
+		lon, err2 := strconv.ParseFloat(fields[5], 64)
+		if err1 != nil || err2 != nil {
+			return
+		}
+
+		c := city{
+			name:    fields[1],
+			lat:     lat,
+			lon:     lon,
+			country: fields[8],
+			admin1:  fields[8] + "." + fields[10],
+		}
+
+		k := cellOf(lat, lon)
+		g.cells[k] = append(g.cells[k], c)
+		n++
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no cities in %s", path)
+	}
+
+	// optional, names fall back to codes
+	readTsv(filepath.Join(dir, "admin1CodesASCII.txt"), func(fields []string) {
+		if len(fields) >= 2 {
+			g.regions[fields[0]] = fields[1]
+		}
+	})
+
+	readTsv(filepath.Join(dir, "countryInfo.txt"), func(fields []string) {
+		if len(fields) >= 5 {
+			g.countries[fields[0]] = fields[4]
+		}
+	})
+
+	return g, nil
+}
+
+func readTsv(path string, fn func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024) // alternate names make long lines
+	for sc.Scan() {
+		line := sc.Text()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		fn(strings.Split(line, "\t"))
+	}
+
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	return nil
+}
+
+func cellOf(lat, lon float64) cell {
+	return cell{int(math.Floor(lat)), int(math.Floor(lon))}
+}
+
+// great circle distance
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dp := p2 - p1
+	dl := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dp/2)*math.Sin(dp/2) + math.Cos(p1)*math.Cos(p2)*math.Sin(dl/2)*math.Sin(dl/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// nearest city within maxKm, false when there is none (open sea, poles)
+// or no dataset was loaded
+func (g *Geocoder) Lookup(lat, lon float64) (models.Place, bool) {
+	if g == nil {
+		return models.Place{}, false
+	}
+
+	// cells are narrower towards the poles, widen the search to cover maxKm
+	rlat := int(math.Ceil(g.maxKm/111)) + 1
+	rlon := 180
+	if c := math.Cos(lat * math.Pi / 180); c > 0.1 {
+		rlon = int(math.Ceil(g.maxKm/(111*c))) + 1
+	}
+
+	k := cellOf(lat, lon)
+	best, bestKm := city{}, math.Inf(1)
+	for dy := -rlat; dy <= rlat; dy++ {
+		for dx := -rlon; dx <= rlon; dx++ {
+			x := k.lon + dx
+			// wrap around the antimeridian
+			x = ((x+180)%360+360)%360 - 180
+
+			for _, c := range g.cells[cell{k.lat + dy, x}] {
+				if d := distanceKm(lat, lon, c.lat, c.lon); d < bestKm {
+					best, bestKm = c, d
+				}
+			}
+		}
+	}
+
+	if bestKm > g.maxKm {
+		return models.Place{}, false
+	}
+
+	p := models.Place{
+		Country: g.countries[best.country],
+		Region:  g.regions[best.admin1],
+		City:    best.name,
+	}
+	if len(p.Country) == 0 {
+		p.Country = best.country
+	}
+
+	return p, true
+}
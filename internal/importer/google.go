@@ -0,0 +1,173 @@
+package importer
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// takeout cuts file names (sidecars included) to this many characters
+const googleNameLimit = 51
+
+// "-edited" copies have no sidecar of their own
+var googleEditedSuffixes = []string{"-edited", "-bearbeitet", "-modifié", "-editado", "-modificato", "-편집됨"}
+
+// IMG_1234(1).jpg -> IMG_1234, (1), .jpg
+var googleCounter = regexp.MustCompile(`^(.*)(\(\d+\))(\.[^.]+)$`)
+
+type googleTime struct {
+	Timestamp string `json:"timestamp"` // unix seconds
+}
+
+type googleGeo struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type googleSidecar struct {
+	Title          string      `json:"title"`
+	Description    string      `json:"description"`
+	PhotoTakenTime *googleTime `json:"photoTakenTime"`
+	GeoData        *googleGeo  `json:"geoData"`
+	GeoDataExif    *googleGeo  `json:"geoDataExif"`
+}
+
+// album folders carry a metadata.json with the real album title
+type googleAlbum struct {
+	Title string `json:"title"`
+}
+
+func parseGoogleSidecar(data []byte) *sidecar {
+	var gs googleSidecar
+	if err := json.Unmarshal(data, &gs); err != nil || gs.PhotoTakenTime == nil {
+		return nil
+	}
+
+	sc := &sidecar{
+		OriginalName: gs.Title,
+		Caption:      strings.TrimSpace(gs.Description),
+	}
+
+	if ts, err := strconv.ParseInt(gs.PhotoTakenTime.Timestamp, 10, 64); err == nil && ts > 0 {
+		taken := time.Unix(ts, 0).UTC()
+		sc.TakenAt = &taken
+	}
+
+	// geoData holds manual edits, 0,0 means no location
+	for _, geo := range []*googleGeo{gs.GeoData, gs.GeoDataExif} {
+		if geo != nil && (geo.Latitude != 0 || geo.Longitude != 0) {
+			lat, lon := geo.Latitude, geo.Longitude
+			sc.Latitude, sc.Longitude = &lat, &lon
+			break
+		}
+	}
+
+	return sc
+}
+
+// strips edited suffixes, reports whether the name was an edited copy
+func googleOriginalName(name string) (string, bool) {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for _, suffix := range googleEditedSuffixes {
+		if strings.HasSuffix(stem, suffix) {
+			return strings.TrimSuffix(stem, suffix) + ext, true
+		}
+	}
+
+	return name, false
+}
+
+// sidecar names a media file may have, most specific first
+//
+//	IMG_1234.jpg      -> IMG_1234.jpg.json, IMG_1234.jpg.supplemental-metadata.json
+//	IMG_1234(1).jpg   -> IMG_1234.jpg(1).json, IMG_1234.jpg.supplemental-metadata(1).json
+func googleSidecarNames(name string) []string {
+	counter := ""
+	if m := googleCounter.FindStringSubmatch(name); m != nil {
+		name, counter = m[1]+m[3], m[2]
+	}
+
+	return []string{
+		name + counter + ".json",
+		name + ".supplemental-metadata" + counter + ".json",
+		strings.TrimSuffix(name, path.Ext(name)) + counter + ".json",
+	}
+}
+
+// a sidecar name that was cut at the limit matches when it is a prefix
+// of what the full name would have been
+func googleTruncatedMatch(sidecarName string, full []string) bool {
+	if len(sidecarName) < googleNameLimit-5 {
+		return false
+	}
+
+	stem := strings.TrimSuffix(sidecarName, ".json")
+	for _, f := range full {
+		if strings.HasPrefix(strings.TrimSuffix(f, ".json"), stem) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *sidecars) findGoogle(p string) *sidecar {
+	dir, base := path.Split(p)
+
+	name, edited := googleOriginalName(base)
+	candidates := googleSidecarNames(name)
+
+	var sc *sidecar
+	for _, c := range candidates {
+		if data, ok := s.data[dir+c]; ok {
+			if sc = parseGoogleSidecar(data); sc != nil {
+				break
+			}
+		}
+	}
+
+	if sc == nil {
+		for _, sp := range s.byDir[dir] {
+			if googleTruncatedMatch(path.Base(sp), candidates) {
+				if sc = parseGoogleSidecar(s.data[sp]); sc != nil {
+					break
+				}
+			}
+		}
+	}
+
+	if sc == nil {
+		return nil
+	}
+
+	// the title is the untruncated name of the original, not of edited copies
+	if edited || !strings.EqualFold(path.Ext(sc.OriginalName), path.Ext(base)) {
+		sc.OriginalName = base
+	}
+
+	if album := s.googleAlbum(dir); len(album) > 0 {
+		sc.Albums = []string{album}
+	}
+
+	return sc
+}
+
+// "Photos from 2019" folders have no metadata.json and are not albums
+func (s *sidecars) googleAlbum(dir string) string {
+	data, ok := s.data[dir+"metadata.json"]
+	if !ok {
+		return ""
+	}
+
+	var album googleAlbum
+	if err := json.Unmarshal(data, &album); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(album.Title)
+}
@@ -0,0 +1,297 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// keeps job results small for sources with thousands of unsupported files
+const maxIssues = 500
+
+var errMimeMismatch = errors.New("content doesn't match the extension")
+
+// walks a directory or archive and stores every allowed file like an upload
+type Importer struct {
+	pg   *db.Postgres
+	conf *config.Config
+	// called for every inserted file, e.g. to queue thumbnails
+	onInsert func(file models.File)
+}
+
+func New(pg *db.Postgres, conf *config.Config, onInsert func(file models.File)) *Importer {
+	return &Importer{
+		pg:       pg,
+		conf:     conf,
+		onInsert: onInsert,
+	}
+}
+
+// os & tool junk, and the sidecars themselves
+func ignored(p string) bool {
+	base := path.Base(p)
+
+	if strings.HasPrefix(base, ".") || strings.HasPrefix(p, "__MACOSX/") {
+		return true
+	}
+
+	switch strings.ToLower(base) {
+	case "thumbs.db", "desktop.ini":
+		return true
+	}
+
+	return strings.EqualFold(path.Ext(base), ".json")
+}
+
+// progress is called after every file, it may be nil
+func (im *Importer) Run(username, src string, progress func(done, total int)) (models.ImportSummary, error) {
+	var summary models.ImportSummary
+
+	if _, err := im.pg.QueryUser(username); err != nil {
+		return summary, fmt.Errorf("unknown user: %s", username)
+	}
+
+	s, err := openSource(src)
+	if err != nil {
+		return summary, err
+	}
+	defer s.Close()
+
+	// first pass - count files and load sidecars
+	total := 0
+	side := newSidecars()
+
+	err = s.walk(func(e entry) error {
+		if !strings.EqualFold(path.Ext(e.path), ".json") {
+			if !ignored(e.path) {
+				total++
+			}
+			return nil
+		}
+
+		if e.size > maxSidecarSize {
+			return nil
+		}
+
+		r, err := e.open()
+		if err != nil {
+			return nil
+		}
+		defer r.Close()
+
+		data, err := io.ReadAll(r)
+		if err == nil {
+			side.add(e.path, data)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	dir := filepath.Join(im.conf.UploadPath(), username)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return summary, fmt.Errorf("failed to create upload directory: %v", err)
+	}
+
+	done := 0
+	err = s.walk(func(e entry) error {
+		if ignored(e.path) {
+			return nil
+		}
+
+		status, reason := im.importEntry(username, dir, e, side.find(e.path))
+		switch status {
+		case "":
+			summary.Imported++
+		case models.ImportSkipped:
+			summary.Skipped++
+		case models.ImportFailed:
+			summary.Failed++
+		}
+
+		if len(status) > 0 && len(summary.Issues) < maxIssues {
+			summary.Issues = append(summary.Issues, models.ImportIssue{Path: e.path, Status: status, Reason: reason})
+		}
+
+		done++
+		if progress != nil {
+			progress(done, total)
+		}
+
+		return nil
+	})
+
+	return summary, err
+}
+
+// returns an empty status when the file was imported
+func (im *Importer) importEntry(username, dir string, e entry, sc *sidecar) (string, string) {
+	name := path.Base(e.path)
+	if sc != nil && len(sc.OriginalName) > 0 {
+		name = sc.OriginalName
+	}
+
+	if len(name) > 255 {
+		return models.ImportFailed, "filename too long"
+	}
+
+	mimeType, err := utils.GetAllowedMimeType(name)
+	if err != nil {
+		return models.ImportSkipped, err.Error()
+	}
+
+	tmp, size, hash, mimeType, err := im.copy(dir, e, mimeType)
+	if errors.Is(err, errMimeMismatch) {
+		return models.ImportSkipped, err.Error()
+	}
+	if err != nil {
+		return models.ImportFailed, err.Error()
+	}
+	defer os.Remove(tmp) // no-op once renamed into place
+
+	// same check upload relies on, done here to keep trashed files trashed
+	if existing, err := im.pg.QueryFileByHash(hash); err == nil {
+
+		if existing.Username != username {
+			return models.ImportSkipped, "duplicate of a file owned by another user"
+		}
+		if existing.Deleted {
+			return models.ImportSkipped, "duplicate of a file in trash"
+		}
+
+		// takeouts repeat a photo in every album it belongs to
+		if sc != nil {
+			im.applyAlbums(username, existing.ID, sc.Albums)
+		}
+
+		return models.ImportSkipped, "duplicate"
+	}
+
+	safename := utils.GenerateUniqueFilename() + filepath.Ext(name)
+	dst := filepath.Join(dir, safename)
+	if err := os.Rename(tmp, dst); err != nil {
+		return models.ImportFailed, err.Error()
+	}
+
+	file := models.File{
+		Hash:         hash,
+		Username:     username,
+		OriginalName: name,
+		StoredName:   safename,
+		FilePath:     dst,
+		RelativePath: "/static" + strings.TrimPrefix(dst, im.conf.UploadPath()),
+		FileSize:     size,
+		MimeType:     mimeType,
+	}
+
+	file.ID, err = im.pg.InsertFile(file)
+	if err != nil {
+		os.Remove(dst)
+		return models.ImportFailed, err.Error()
+	}
+
+	if sc != nil {
+		im.applySidecar(username, file.ID, sc)
+	}
+
+	if im.onInsert != nil {
+		im.onInsert(file)
+	}
+
+	return "", ""
+}
+
+// checks the content against the claimed mime type before anything is written,
+// then hashes it into a temp file in dir that the caller renames or drops.
+// returns the temp path and the detected mime type
+func (im *Importer) copy(dir string, e entry, claimed string) (string, int64, string, string, error) {
+	r, err := e.open()
+	if err != nil {
+		return "", 0, "", "", fmt.Errorf("failed to open: %v", err)
+	}
+	defer r.Close()
+
+	head, body, err := utils.PeekHead(r)
+	if err != nil {
+		return "", 0, "", "", fmt.Errorf("failed to read: %v", err)
+	}
+
+	mimeType, err := utils.DetectMimeType(head, claimed)
+	if err != nil {
+		return "", 0, "", "", fmt.Errorf("%w: %v", errMimeMismatch, err)
+	}
+
+	out, err := os.CreateTemp(dir, utils.IMPORT_TMP_PREFIX+"*")
+	if err != nil {
+		return "", 0, "", "", fmt.Errorf("failed to create: %v", err)
+	}
+	defer out.Close()
+
+	size, hash, err := utils.CopyAndHash(out, body)
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", 0, "", "", fmt.Errorf("failed to copy: %v", err)
+	}
+
+	return out.Name(), size, hash, mimeType, nil
+}
+
+// best effort - the file is imported either way
+func (im *Importer) applySidecar(username string, fileId int, sc *sidecar) {
+	id := strconv.Itoa(fileId)
+
+	if sc.TakenAt != nil {
+		if err := im.pg.SetTakenAt(fileId, *sc.TakenAt); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if sc.Latitude != nil && sc.Longitude != nil {
+		if err := im.pg.SetLocation(fileId, *sc.Latitude, *sc.Longitude); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if len(sc.Caption) > 0 {
+		if err := im.pg.UpdateCaption(username, id, sc.Caption); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if tags, err := utils.NormalizeTags(sc.Tags); err == nil && len(tags) > 0 {
+		if err := im.pg.SetFileTags(username, id, tags); err != nil {
+			log.Println(err)
+		}
+	}
+
+	im.applyAlbums(username, fileId, sc.Albums)
+}
+
+func (im *Importer) applyAlbums(username string, fileId int, albums []string) {
+	for _, name := range albums {
+		albumId, err := im.pg.GetOrCreateAlbum(username, name)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if err := im.pg.AddAlbumFiles(username, strconv.Itoa(albumId), []int{fileId}); err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"encoding/json"
+	"kmem/internal/models"
+	"path"
+	"time"
+)
+
+// sidecars bigger than this are not read into memory
+const maxSidecarSize = 1 << 20
+
+// metadata found next to a file in the import source
+type sidecar struct {
+	OriginalName string
+	TakenAt      *time.Time
+	Caption      string
+	Tags         []string
+	Albums       []string
+	Latitude     *float64
+	Longitude    *float64
+}
+
+// json files of the source, loaded before importing
+type sidecars struct {
+	data  map[string][]byte   // by path
+	byDir map[string][]string // "dir/" -> paths, for truncated names
+}
+
+func newSidecars() *sidecars {
+	return &sidecars{
+		data:  make(map[string][]byte),
+		byDir: make(map[string][]string),
+	}
+}
+
+func (s *sidecars) add(p string, data []byte) {
+	dir, _ := path.Split(p)
+
+	s.data[p] = data
+	s.byDir[dir] = append(s.byDir[dir], p)
+}
+
+func (s *sidecars) find(p string) *sidecar {
+	// kmem takeout - originals/<name>.json
+	if data, ok := s.data[p+".json"]; ok {
+		if sc := parseKmemSidecar(data); sc != nil {
+			return sc
+		}
+	}
+
+	// google takeout
+	return s.findGoogle(p)
+}
+
+func parseKmemSidecar(data []byte) *sidecar {
+	var ef models.ExportFile
+	if err := json.Unmarshal(data, &ef); err != nil || len(ef.Hash) == 0 {
+		return nil
+	}
+
+	sc := &sidecar{
+		OriginalName: ef.OriginalName,
+		TakenAt:      ef.TakenAt,
+		Caption:      ef.Caption,
+		Tags:         ef.Tags,
+		Albums:       ef.Albums,
+	}
+
+	if ef.Metadata != nil {
+		sc.Latitude = ef.Metadata.Latitude
+		sc.Longitude = ef.Metadata.Longitude
+	}
+
+	return sc
+}
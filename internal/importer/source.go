@@ -0,0 +1,174 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type entry struct {
+	path    string // slash separated, relative to the source root
+	size    int64
+	modTime time.Time
+	// only valid inside the walk callback for streamed sources (tar)
+	open func() (io.ReadCloser, error)
+}
+
+type source interface {
+	walk(fn func(e entry) error) error
+	Close() error
+}
+
+// a directory, .zip, .tar, .tar.gz or .tgz
+func openSource(src string) (source, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", src, err)
+	}
+
+	if info.IsDir() {
+		return &dirSource{root: src}, nil
+	}
+
+	lower := strings.ToLower(src)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		r, err := zip.OpenReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip %s: %v", src, err)
+		}
+		return &zipSource{r: r}, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return &tarSource{path: src}, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return &tarSource{path: src, gzipped: true}, nil
+	default:
+		return nil, fmt.Errorf("unsupported import source: %s", src)
+	}
+}
+
+type dirSource struct {
+	root string
+}
+
+func (d *dirSource) walk(fn func(e entry) error) error {
+	return filepath.WalkDir(d.root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if de.IsDir() || !de.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(d.root, path)
+		if err != nil {
+			return err
+		}
+
+		return fn(entry{
+			path:    filepath.ToSlash(rel),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			open:    func() (io.ReadCloser, error) { return os.Open(path) },
+		})
+	})
+}
+
+func (d *dirSource) Close() error {
+	return nil
+}
+
+type zipSource struct {
+	r *zip.ReadCloser
+}
+
+func (z *zipSource) walk(fn func(e entry) error) error {
+	for _, f := range z.r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		err := fn(entry{
+			path:    f.Name,
+			size:    int64(f.UncompressedSize64),
+			modTime: f.Modified,
+			open:    f.Open,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *zipSource) Close() error {
+	return z.r.Close()
+}
+
+// tar is sequential, every walk reads the archive from the start
+type tarSource struct {
+	path    string
+	gzipped bool
+}
+
+func (t *tarSource) walk(fn func(e entry) error) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open tar %s: %v", t.path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if t.gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip %s: %v", t.path, err)
+		}
+		defer gz.Close()
+
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar %s: %v", t.path, err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		err = fn(entry{
+			path:    strings.TrimPrefix(hdr.Name, "./"),
+			size:    hdr.Size,
+			modTime: hdr.ModTime,
+			open:    func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *tarSource) Close() error {
+	return nil
+}
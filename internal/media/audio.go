@@ -0,0 +1,46 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// color of the waveform drawn on a transparent background
+const waveColor = "0x5b7db1"
+
+// amplitude of the whole file as one picture, mono mixed down
+func Waveform(path string, width, height int) (image.Image, error) {
+	return ffmpegStill(path, "png",
+		"-filter_complex", fmt.Sprintf("aformat=channel_layouts=mono,showwavespic=s=%dx%d:colors=%s", width, height, waveColor),
+	)
+}
+
+// embedded cover art (id3 APIC, flac picture, mp4 covr)
+func CoverArt(path string) (image.Image, error) {
+	return ffmpegStill(path, "png", "-an", "-map", "0:v:0")
+}
+
+// the first frame ffmpeg outputs for args, through a temp file
+func ffmpegStill(path, format string, args ...string) (image.Image, error) {
+	tmp, err := os.CreateTemp("", "kmem-*"+Extensions[format])
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	args = append([]string{"-i", path}, args...)
+	args = append(args, "-frames:v", "1", "-y", tmp.Name())
+
+	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, lines[len(lines)-1])
+	}
+
+	return imaging.Open(tmp.Name())
+}
@@ -0,0 +1,212 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// tiff tags for embedded previews
+const (
+	tagSubIFDs           = 0x014a
+	tagCompression       = 0x0103
+	tagStripOffsets      = 0x0111
+	tagStripByteCounts   = 0x0117
+	tagJPEGInterchange   = 0x0201
+	tagJPEGInterchangeLn = 0x0202
+)
+
+const maxPreviewSize = 64 << 20
+
+// browsers can't show these, they get a jpeg/webp display rendition
+var convertedTypes = map[string]bool{
+	"image/heic":        true,
+	"image/heif":        true,
+	"image/x-adobe-dng": true,
+	"image/x-canon-cr2": true,
+	"image/x-nikon-nef": true,
+	"image/x-sony-arw":  true,
+}
+
+func NeedsDisplay(mimeType string) bool {
+	return convertedTypes[mimeType]
+}
+
+// decodes anything the upload accepts as an image, heic through libheif or
+// ffmpeg and raw files through their embedded jpeg preview. the result is
+// upright, exif orientation is already applied
+func DecodeImage(path, mimeType string) (image.Image, error) {
+	switch mimeType {
+	case "image/heic", "image/heif":
+		// both apply the heif transform properties themselves
+		return decodeHeif(path)
+	case "image/x-adobe-dng", "image/x-canon-cr2", "image/x-nikon-nef", "image/x-sony-arw":
+		img, err := decodeRawPreview(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// previews rarely carry their own exif, the raw's ifd0 tells
+		if ex, err := ReadExif(path); err == nil {
+			img = Orient(img, ex.Orientation)
+		}
+
+		return img, nil
+	default:
+		return imaging.Open(path, imaging.AutoOrientation(true))
+	}
+}
+
+func decodeHeif(path string) (image.Image, error) {
+	tmp, err := os.CreateTemp("", "kmem-*.png")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	// libheif handles the tiled images iphones write, older ffmpeg doesn't
+	if _, err := exec.LookPath("heif-convert"); err == nil {
+		if err := exec.Command("heif-convert", path, tmp.Name()).Run(); err == nil {
+			return imaging.Open(tmp.Name())
+		}
+	}
+
+	out, err := exec.Command("ffmpeg", "-i", path, "-frames:v", "1", "-y", tmp.Name()).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg heif: %v: %s", err, lastLine(out))
+	}
+
+	return imaging.Open(tmp.Name())
+}
+
+// dng, cr2, nef and arw are all tiff, the largest jpeg found in the
+// ifd chain or sub ifds is the camera's full size preview
+func decodeRawPreview(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, exifScanLimit)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+
+	previews, err := findPreviews(head[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	// biggest first, lossless jpeg raw data looks like a preview until decoded
+	sort.Slice(previews, func(i, j int) bool { return previews[i][1] > previews[j][1] })
+
+	for _, p := range previews {
+		if p[1] > maxPreviewSize {
+			continue
+		}
+
+		data := make([]byte, p[1])
+		if _, err := f.ReadAt(data, int64(p[0])); err != nil {
+			continue
+		}
+
+		if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+			continue
+		}
+
+		if img, err := jpeg.Decode(bytes.NewReader(data)); err == nil {
+			return img, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no embedded preview")
+}
+
+// offset, length of every jpeg referenced from the ifds in head
+func findPreviews(head []byte) ([][2]uint32, error) {
+	if len(head) < 8 {
+		return nil, fmt.Errorf("file too short")
+	}
+
+	t := tiffReader{data: head}
+	switch string(head[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a tiff based raw file")
+	}
+
+	var previews [][2]uint32
+	seen := make(map[uint32]bool)
+
+	var walk func(offset uint32, depth int)
+	walk = func(offset uint32, depth int) {
+		// broken or hostile files can loop
+		for offset != 0 && !seen[offset] && depth < 4 {
+			seen[offset] = true
+
+			entries, err := t.readIFD(offset)
+			if err != nil {
+				return
+			}
+
+			var jpegOffset, jpegLength, stripOffset, stripLength, compression uint32
+			for _, e := range entries {
+				switch e.tag {
+				case tagJPEGInterchange:
+					jpegOffset = t.uint(e)
+				case tagJPEGInterchangeLn:
+					jpegLength = t.uint(e)
+				case tagStripOffsets:
+					if e.count == 1 {
+						stripOffset = t.uint(e)
+					}
+				case tagStripByteCounts:
+					if e.count == 1 {
+						stripLength = t.uint(e)
+					}
+				case tagCompression:
+					compression = t.uint(e)
+				case tagSubIFDs:
+					for _, sub := range t.uints(e) {
+						walk(sub, depth+1)
+					}
+				case tagExifIFD:
+					walk(e.offset, depth+1)
+				}
+			}
+
+			if jpegOffset > 0 && jpegLength > 0 {
+				previews = append(previews, [2]uint32{jpegOffset, jpegLength})
+			}
+			// jpeg strips, 7 is also used for lossless raw data which fails to decode
+			if (compression == 6 || compression == 7) && stripOffset > 0 && stripLength > 0 {
+				previews = append(previews, [2]uint32{stripOffset, stripLength})
+			}
+
+			// next ifd in the chain
+			end := int(offset) + 2 + len(entries)*12
+			if end+4 > len(head) {
+				return
+			}
+			offset = t.order.Uint32(head[end:])
+		}
+	}
+
+	walk(t.order.Uint32(head[4:8]), 0)
+
+	return previews, nil
+}
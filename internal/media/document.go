@@ -0,0 +1,167 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/norm"
+)
+
+// documents are drawn on a portrait page, scaled up afterwards so the
+// bitmap font stays crisp
+const (
+	pageW       = 300
+	pageH       = 400
+	pageScale   = 2
+	pageMargin  = 12
+	snippetSize = 8 << 10
+)
+
+var (
+	pageInk    = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	pageBorder = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+	iconBand   = color.RGBA{0x5b, 0x7d, 0xb1, 0xff}
+)
+
+// first page of a pdf through poppler's pdftoppm, its longest side maxSide
+func RenderPdf(path string, maxSide int) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "kmem-pdf-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "page")
+	cmd := exec.Command("pdftoppm",
+		"-f", "1", "-l", "1",
+		"-singlefile",
+		"-png",
+		"-scale-to", fmt.Sprint(maxSide),
+		path, out,
+	)
+
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm: %v: %s", err, strings.TrimSpace(string(msg)))
+	}
+
+	return imaging.Open(out + ".png")
+}
+
+// the beginning of a text file (plain, markdown, csv...) typed on a page
+func RenderText(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, snippetSize)
+	n, _ := io.ReadFull(f, buf) // short files end early
+	buf = buf[:n]
+
+	// a multi byte character may be split by the read
+	for i := 0; i < utf8.UTFMax-1 && len(buf) > 0 && !utf8.Valid(buf); i++ {
+		buf = buf[:len(buf)-1]
+	}
+	if !utf8.Valid(buf) || bytes.IndexByte(buf, 0) >= 0 {
+		return nil, fmt.Errorf("not utf-8 text")
+	}
+
+	face := basicfont.Face7x13
+	cols := (pageW - 2*pageMargin) / face.Advance
+	rows := (pageH - 2*pageMargin) / face.Height
+
+	var lines []string
+	sc := bufio.NewScanner(strings.NewReader(string(buf)))
+	for sc.Scan() && len(lines) < rows {
+		line := []rune(asciiOnly(strings.ReplaceAll(sc.Text(), "\t", "    ")))
+		if len(line) > cols {
+			line = line[:cols]
+		}
+		lines = append(lines, string(line))
+	}
+
+	page := blankPage()
+	for i, line := range lines {
+		drawString(page, face, pageMargin, pageMargin+(i+1)*face.Height-face.Descent, line, pageInk)
+	}
+
+	return imaging.Resize(page, pageW*pageScale, pageH*pageScale, imaging.NearestNeighbor), nil
+}
+
+// placeholder page with the type written on it, for anything that has no
+// previewer or whose previewer failed
+func Icon(label string) image.Image {
+	page := blankPage()
+
+	band := image.Rect(pageMargin, pageH/2-40, pageW-pageMargin, pageH/2+40)
+	draw.Draw(page, band, image.NewUniform(iconBand), image.Point{}, draw.Src)
+
+	// typed small then blown up, the bitmap font only comes in one size
+	face := basicfont.Face7x13
+	const zoom = 4
+	maxRunes := (band.Dx() - 2*pageMargin) / (face.Advance * zoom)
+	label = strings.ToUpper(label)
+	if utf8.RuneCountInString(label) > maxRunes {
+		label = string([]rune(label)[:maxRunes])
+	}
+
+	w := utf8.RuneCountInString(label) * face.Advance
+	text := image.NewRGBA(image.Rect(0, 0, max(w, 1), face.Height))
+	drawString(text, face, 0, face.Ascent, label, color.White)
+
+	big := imaging.Resize(text, text.Bounds().Dx()*zoom, text.Bounds().Dy()*zoom, imaging.NearestNeighbor)
+	at := image.Pt((pageW-big.Bounds().Dx())/2, (pageH-big.Bounds().Dy())/2)
+	draw.Draw(page, big.Bounds().Add(at), big, image.Point{}, draw.Over)
+
+	return imaging.Resize(page, pageW*pageScale, pageH*pageScale, imaging.NearestNeighbor)
+}
+
+// the bitmap font is ascii only: accents are dropped, anything else is a ?
+func asciiOnly(s string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r < 0x20 || r > 0x7e:
+			sb.WriteByte('?')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+func blankPage() *image.RGBA {
+	page := image.NewRGBA(image.Rect(0, 0, pageW, pageH))
+	draw.Draw(page, page.Bounds(), image.NewUniform(pageBorder), image.Point{}, draw.Src)
+	draw.Draw(page, page.Bounds().Inset(1), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	return page
+}
+
+func drawString(dst draw.Image, face font.Face, x, y int, s string, c color.Color) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
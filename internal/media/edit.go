@@ -0,0 +1,142 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"kmem/internal/models"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// applies an exif orientation (1-8) so the image displays upright
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
+}
+
+// imaging rotates counter-clockwise, edit angles are clockwise
+func ApplyEdits(img image.Image, ops []models.EditOp) image.Image {
+	for _, op := range ops {
+		switch op.Op {
+		case models.EditCrop:
+			// at least a pixel, however small the image got
+			b := img.Bounds()
+			w, h := float64(b.Dx()), float64(b.Dy())
+			x0 := min(int(math.Round(op.X*w)), b.Dx()-1)
+			y0 := min(int(math.Round(op.Y*h)), b.Dy()-1)
+			x1 := max(int(math.Round((op.X+op.Width)*w)), x0+1)
+			y1 := max(int(math.Round((op.Y+op.Height)*h)), y0+1)
+			img = imaging.Crop(img, image.Rect(x0, y0, x1, y1).Add(b.Min))
+		case models.EditAdjust:
+			if op.Brightness != 0 {
+				img = imaging.AdjustBrightness(img, op.Brightness)
+			}
+			if op.Contrast != 0 {
+				img = imaging.AdjustContrast(img, op.Contrast)
+			}
+			if op.Saturation != 0 {
+				img = imaging.AdjustSaturation(img, op.Saturation)
+			}
+		case models.EditFilter:
+			img = applyFilter(img, op.Name)
+		case models.EditRotate:
+			switch op.Angle {
+			case 90:
+				img = imaging.Rotate270(img)
+			case 180:
+				img = imaging.Rotate180(img)
+			case 270:
+				img = imaging.Rotate90(img)
+			}
+		case models.EditFlip:
+			if op.Axis == "horizontal" {
+				img = imaging.FlipH(img)
+			} else {
+				img = imaging.FlipV(img)
+			}
+		}
+	}
+
+	return img
+}
+
+func applyFilter(img image.Image, name string) image.Image {
+	switch name {
+	case "grayscale":
+		return imaging.Grayscale(img)
+	case "sepia":
+		return imaging.AdjustFunc(imaging.Grayscale(img), func(c color.NRGBA) color.NRGBA {
+			v := float64(c.R)
+			return color.NRGBA{
+				R: uint8(min(255, v*1.07+20)),
+				G: uint8(min(255, v*0.95+8)),
+				B: uint8(v * 0.78),
+				A: c.A,
+			}
+		})
+	case "invert":
+		return imaging.Invert(img)
+	case "sharpen":
+		return imaging.Sharpen(img, 1)
+	case "blur":
+		return imaging.Blur(img, 2)
+	default:
+		return img
+	}
+}
+
+// rotations and flips as an ffmpeg filter chain, prepended to -vf of video
+// derivatives. empty when there's nothing to do
+func EditFilter(ops []models.EditOp) string {
+	var filters []string
+	for _, op := range ops {
+		switch op.Op {
+		case models.EditRotate:
+			switch op.Angle {
+			case 90:
+				filters = append(filters, "transpose=clock")
+			case 180:
+				filters = append(filters, "hflip", "vflip")
+			case 270:
+				filters = append(filters, "transpose=cclock")
+			}
+		case models.EditFlip:
+			if op.Axis == "horizontal" {
+				filters = append(filters, "hflip")
+			} else {
+				filters = append(filters, "vflip")
+			}
+		}
+	}
+
+	return strings.Join(filters, ",")
+}
+
+// video size after the edits, quarter turns swap width and height
+func EditedSize(w, h int, ops []models.EditOp) (int, int) {
+	for _, op := range ops {
+		if op.Op == models.EditRotate && op.Angle != 180 {
+			w, h = h, w
+		}
+	}
+
+	return w, h
+}
@@ -0,0 +1,128 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"kmem/internal/models"
+	"os"
+	"os/exec"
+
+	"github.com/disintegration/imaging"
+)
+
+// encoders ffmpeg has to provide for the formats go can't write
+var ffmpegCodecs = map[string][]string{
+	"webp": {"-c:v", "libwebp", "-quality", "80"},
+	"avif": {"-c:v", "libaom-av1", "-still-picture", "1", "-crf", "32", "-cpu-used", "6"},
+}
+
+var Extensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"webp": ".webp",
+	"avif": ".avif",
+}
+
+// jpeg has no alpha, transparent pixels would turn black
+func flatten(img image.Image) image.Image {
+	b := img.Bounds()
+	bg := imaging.New(b.Dx(), b.Dy(), color.White)
+	return imaging.Overlay(bg, img, image.Pt(0, 0), 1.0)
+}
+
+// encodes img as jpeg, png, webp or avif
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		return imaging.Encode(w, flatten(img), imaging.JPEG, imaging.JPEGQuality(85))
+	case "png":
+		return imaging.Encode(w, img, imaging.PNG)
+	}
+
+	codec, ok := ffmpegCodecs[format]
+	if !ok {
+		return fmt.Errorf("unsupported image format: %s", format)
+	}
+
+	var in bytes.Buffer
+	if err := png.Encode(&in, img); err != nil {
+		return err
+	}
+
+	// some muxers seek back, so no pipe on the output side
+	tmp, err := os.CreateTemp("", "kmem-*"+Extensions[format])
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	args := append([]string{"-f", "image2pipe", "-c:v", "png", "-i", "-"}, codec...)
+	args = append(args, "-y", tmp.Name())
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdin = &in
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg %s: %v: %s", format, err, lastLine(out))
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func EncodeFile(dst string, img image.Image, format string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := Encode(f, img, format); err != nil {
+		f.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return f.Close()
+}
+
+// keeps every frame of an animated gif, width x height should keep the aspect ratio
+// of the edited frames
+func AnimatedWebp(src, dst string, width, height int, edits []models.EditOp) error {
+	vf := fmt.Sprintf("scale=%d:%d", width, height)
+	if ef := EditFilter(edits); len(ef) > 0 {
+		vf = ef + "," + vf
+	}
+
+	cmd := exec.Command("ffmpeg",
+		"-i", src,
+		"-vf", vf,
+		"-c:v", "libwebp",
+		"-quality", "75",
+		"-loop", "0",
+		"-an",
+		"-y",
+		dst,
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("ffmpeg animated webp: %v: %s", err, lastLine(out))
+	}
+
+	return nil
+}
+
+func lastLine(out []byte) string {
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	return string(lines[len(lines)-1])
+}
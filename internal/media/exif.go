@@ -0,0 +1,306 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// tiff tags we care about
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagPixelXDimension  = 0xa002
+	tagPixelYDimension  = 0xa003
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+// only the first bytes are searched for an exif block, raw files keep
+// their main ifds near the start as well
+const exifScanLimit = 1 << 20
+
+type Exif struct {
+	Make        string
+	Model       string
+	TakenAt     *time.Time
+	Orientation int
+	Width       int
+	Height      int
+	Latitude    *float64
+	Longitude   *float64
+}
+
+type ifdEntry struct {
+	tag    uint16
+	typ    uint16
+	count  uint32
+	offset uint32 // value itself when it fits in 4 bytes
+	raw    [4]byte
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// reads exif from jpeg, tiff based raw files (dng, cr2, nef, arw)
+// and anything else that embeds a raw "Exif\0\0" block (heic)
+func ReadExif(path string) (*Exif, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, exifScanLimit)
+	n, err := io.ReadFull(bufio.NewReader(f), head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	tiff, err := findTiff(head)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTiff(tiff)
+}
+
+func findTiff(head []byte) ([]byte, error) {
+	// tiff container (raw files)
+	if bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*")) {
+		return head, nil
+	}
+
+	// jpeg app1, heic exif item, png eXIf chunk ...
+	idx := bytes.Index(head, []byte("Exif\x00\x00"))
+	if idx < 0 {
+		return nil, fmt.Errorf("no exif data")
+	}
+
+	return head[idx+6:], nil
+}
+
+func parseTiff(data []byte) (*Exif, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("exif too short")
+	}
+
+	t := tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid tiff byte order")
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+
+	var ex Exif
+	var dateTime string
+
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagMake:
+			ex.Make = t.str(e)
+		case tagModel:
+			ex.Model = t.str(e)
+		case tagOrientation:
+			ex.Orientation = int(t.uint(e))
+		case tagDateTime:
+			dateTime = t.str(e)
+		case tagExifIFD:
+			sub, err := t.readIFD(e.offset)
+			if err != nil {
+				continue
+			}
+
+			for _, se := range sub {
+				switch se.tag {
+				case tagDateTimeOriginal:
+					dateTime = t.str(se)
+				case tagPixelXDimension:
+					ex.Width = int(t.uint(se))
+				case tagPixelYDimension:
+					ex.Height = int(t.uint(se))
+				}
+			}
+		case tagGPSIFD:
+			sub, err := t.readIFD(e.offset)
+			if err != nil {
+				continue
+			}
+
+			ex.Latitude, ex.Longitude = t.gps(sub)
+		}
+	}
+
+	if taken, err := time.Parse("2006:01:02 15:04:05", dateTime); err == nil {
+		ex.TakenAt = &taken
+	}
+
+	return &ex, nil
+}
+
+func (t tiffReader) readIFD(offset uint32) ([]ifdEntry, error) {
+	if int(offset)+2 > len(t.data) {
+		return nil, fmt.Errorf("ifd offset out of range")
+	}
+
+	cnt := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+cnt*12 > len(t.data) {
+		return nil, fmt.Errorf("ifd out of range")
+	}
+
+	entries := make([]ifdEntry, cnt)
+	for i := range cnt {
+		b := t.data[start+i*12:]
+		entries[i] = ifdEntry{
+			tag:    t.order.Uint16(b[0:]),
+			typ:    t.order.Uint16(b[2:]),
+			count:  t.order.Uint32(b[4:]),
+			offset: t.order.Uint32(b[8:]),
+		}
+		copy(entries[i].raw[:], b[8:12])
+	}
+
+	return entries, nil
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // byte, ascii, sbyte, undefined
+		return 1
+	case 3, 8: // short, sshort
+		return 2
+	case 4, 9, 13: // long, slong, ifd
+		return 4
+	case 5, 10: // rational, srational
+		return 8
+	default:
+		return 0
+	}
+}
+
+// value bytes, inline or at offset
+func (t tiffReader) value(e ifdEntry) []byte {
+	size := typeSize(e.typ) * int(e.count)
+	if size <= 4 {
+		return e.raw[:size]
+	}
+
+	end := int(e.offset) + size
+	if end > len(t.data) || end < 0 {
+		return nil
+	}
+
+	return t.data[e.offset:end]
+}
+
+func (t tiffReader) str(e ifdEntry) string {
+	return strings.TrimSpace(strings.TrimRight(string(t.value(e)), "\x00"))
+}
+
+func (t tiffReader) uint(e ifdEntry) uint32 {
+	b := t.value(e)
+	switch {
+	case e.typ == 3 && len(b) >= 2:
+		return uint32(t.order.Uint16(b))
+	case (e.typ == 4 || e.typ == 13) && len(b) >= 4:
+		return t.order.Uint32(b)
+	default:
+		return 0
+	}
+}
+
+func (t tiffReader) uints(e ifdEntry) []uint32 {
+	if e.typ != 4 && e.typ != 13 {
+		return nil
+	}
+
+	b := t.value(e)
+
+	var vals []uint32
+	for i := 0; i+4 <= len(b); i += 4 {
+		vals = append(vals, t.order.Uint32(b[i:]))
+	}
+
+	return vals
+}
+
+func (t tiffReader) rationals(e ifdEntry) []float64 {
+	b := t.value(e)
+
+	var vals []float64
+	for i := 0; i+8 <= len(b); i += 8 {
+		num := t.order.Uint32(b[i:])
+		den := t.order.Uint32(b[i+4:])
+		if den == 0 {
+			vals = append(vals, 0)
+			continue
+		}
+		vals = append(vals, float64(num)/float64(den))
+	}
+
+	return vals
+}
+
+func (t tiffReader) gps(entries []ifdEntry) (*float64, *float64) {
+	var latRef, lonRef string
+	var lat, lon []float64
+
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = t.str(e)
+		case tagGPSLatitude:
+			lat = t.rationals(e)
+		case tagGPSLongitudeRef:
+			lonRef = t.str(e)
+		case tagGPSLongitude:
+			lon = t.rationals(e)
+		}
+	}
+
+	if len(lat) != 3 || len(lon) != 3 {
+		return nil, nil
+	}
+
+	la := lat[0] + lat[1]/60 + lat[2]/3600
+	lo := lon[0] + lon[1]/60 + lon[2]/3600
+
+	if latRef == "S" {
+		la = -la
+	}
+	if lonRef == "W" {
+		lo = -lo
+	}
+
+	// 0,0 is what many cameras write when they have no fix
+	if la == 0 && lo == 0 {
+		return nil, nil
+	}
+
+	return &la, &lo
+}
@@ -0,0 +1,93 @@
+package media
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// difference hash, a bit per horizontal neighbour pair of a 9x8 grayscale
+// copy. cheap and good at resaves and recompressions
+func DHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+
+	var h uint64
+	for y := range 8 {
+		for x := range 8 {
+			h <<= 1
+			if small.Pix[y*small.Stride+x*4] < small.Pix[y*small.Stride+(x+1)*4] {
+				h |= 1
+			}
+		}
+	}
+
+	return h
+}
+
+// dct hash, the 8x8 lowest frequencies of a 32x32 grayscale copy compared
+// to their median. survives scaling, slight crops and color changes
+func PHash(img image.Image) uint64 {
+	const n = 32
+
+	small := imaging.Grayscale(imaging.Resize(img, n, n, imaging.Box))
+
+	var px [n][n]float64
+	for y := range n {
+		for x := range n {
+			px[y][x] = float64(small.Pix[y*small.Stride+x*4])
+		}
+	}
+
+	// separable 2d dct, only the 8 lowest frequencies are needed per axis
+	var cos [8][n]float64
+	for u := range 8 {
+		for x := range n {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+
+	var rows [n][8]float64
+	for y := range n {
+		for u := range 8 {
+			var sum float64
+			for x := range n {
+				sum += px[y][x] * cos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+
+	var coef [64]float64
+	for v := range 8 {
+		for u := range 8 {
+			var sum float64
+			for y := range n {
+				sum += rows[y][u] * cos[v][y]
+			}
+			coef[v*8+u] = sum
+		}
+	}
+
+	// the dc term is the average brightness, it would skew the median
+	sorted := make([]float64, 63)
+	copy(sorted, coef[1:])
+	sort.Float64s(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+
+	var h uint64
+	for _, c := range coef {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+
+	return h
+}
+
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
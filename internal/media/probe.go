@@ -0,0 +1,187 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Probe struct {
+	Width     int // as stored, see Rotation
+	Height    int
+	Rotation  int // display rotation in degrees, phones record portrait as rotated landscape
+	HasAudio  bool
+	Duration  float64
+	TakenAt   *time.Time
+	Latitude  *float64
+	Longitude *float64
+}
+
+// tags of an audio file, with a flag for embedded cover art
+type AudioProbe struct {
+	Duration float64
+	TakenAt  *time.Time // voice memos carry their recording time
+	Title    string
+	Artist   string
+	Album    string
+	HasCover bool
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		Duration string            `json:"duration"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// ISO 6709, e.g. "+37.5665+126.9780+038.000/"
+var iso6709 = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)`)
+
+func ffprobe(path string) (*ffprobeOutput, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+
+	var out ffprobeOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	return &out, nil
+}
+
+func ProbeVideo(path string) (*Probe, error) {
+	out, err := ffprobe(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Probe
+
+	video := false
+	for _, s := range out.Streams {
+		switch {
+		case s.CodecType == "video" && !video:
+			video = true
+			p.Width = s.Width
+			p.Height = s.Height
+
+			// older ffprobe puts it in the tags, newer in the display matrix
+			if r, err := strconv.Atoi(s.Tags["rotate"]); err == nil {
+				p.Rotation = r
+			}
+			for _, sd := range s.SideDataList {
+				if sd.Rotation != 0 {
+					p.Rotation = int(sd.Rotation)
+				}
+			}
+			p.Rotation = ((p.Rotation % 360) + 360) % 360
+		case s.CodecType == "audio":
+			p.HasAudio = true
+		}
+	}
+
+	p.Duration, _ = strconv.ParseFloat(out.Format.Duration, 64)
+
+	if created, ok := out.Format.Tags["creation_time"]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			p.TakenAt = &t
+		}
+	}
+
+	for _, key := range []string{"com.apple.quicktime.location.ISO6709", "location"} {
+		loc, ok := out.Format.Tags[key]
+		if !ok {
+			continue
+		}
+
+		m := iso6709.FindStringSubmatch(loc)
+		if m == nil {
+			continue
+		}
+
+		lat, _ := strconv.ParseFloat(m[1], 64)
+		lon, _ := strconv.ParseFloat(m[2], 64)
+		p.Latitude, p.Longitude = &lat, &lon
+		break
+	}
+
+	return &p, nil
+}
+
+// id3 tags end up in the format tags, vorbis comments (ogg) in the stream
+// ones, and the case of the keys depends on the muxer
+func ProbeAudio(path string) (*AudioProbe, error) {
+	out, err := ffprobe(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p AudioProbe
+
+	tags := []map[string]string{out.Format.Tags}
+	for _, s := range out.Streams {
+		switch {
+		case s.CodecType == "audio":
+			tags = append(tags, s.Tags)
+		case s.CodecType == "video" && s.Disposition.AttachedPic == 1:
+			p.HasCover = true
+		}
+	}
+
+	tag := func(key string) string {
+		for _, t := range tags {
+			for k, v := range t {
+				if strings.EqualFold(k, key) && len(strings.TrimSpace(v)) > 0 {
+					return strings.TrimSpace(v)
+				}
+			}
+		}
+		return ""
+	}
+
+	p.Duration, _ = strconv.ParseFloat(out.Format.Duration, 64)
+	p.Title = tag("title")
+	p.Artist = tag("artist")
+	p.Album = tag("album")
+
+	if t, err := time.Parse(time.RFC3339Nano, tag("creation_time")); err == nil {
+		p.TakenAt = &t
+	}
+
+	return &p, nil
+}
+
+// width and height the way the video is displayed
+func (p *Probe) DisplaySize() (int, int) {
+	if p.Rotation == 90 || p.Rotation == 270 {
+		return p.Height, p.Width
+	}
+
+	return p.Width, p.Height
+}
@@ -0,0 +1,209 @@
+package memories
+
+import (
+	"fmt"
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"time"
+)
+
+func CacheKey(username string, day time.Time) string {
+	return fmt.Sprintf("memories:%s:%s", username, day.Format(time.DateOnly))
+}
+
+// memories of the user as of today: on this day, this month last year,
+// then trips newest first
+func Build(pg *db.Postgres, username string, today time.Time) (models.MemoriesResponse, error) {
+	resp := models.MemoriesResponse{Date: today.Format(time.DateOnly), Memories: []models.Memory{}}
+
+	moments, err := pg.GetMoments(username)
+	if err != nil {
+		return resp, err
+	}
+
+	var mems []models.Memory
+	mems = append(mems, onThisDay(moments, today)...)
+	mems = append(mems, monthLastYear(moments, today)...)
+	mems = append(mems, trips(moments)...)
+	if len(mems) == 0 {
+		return resp, nil
+	}
+
+	var ids []int
+	for _, m := range mems {
+		ids = append(ids, m.FileIDs...)
+	}
+
+	files, err := pg.GetFileResponsesByIds(username, ids)
+	if err != nil {
+		return resp, err
+	}
+
+	byId := make(map[int]models.FileResponse, len(files))
+	for _, f := range files {
+		byId[f.ID] = f
+	}
+
+	for _, m := range mems {
+		m.Files = make([]models.FileResponse, 0, len(m.FileIDs))
+		for _, id := range m.FileIDs {
+			if f, ok := byId[id]; ok {
+				m.Files = append(m.Files, f)
+			}
+		}
+
+		if len(m.Files) > 0 {
+			resp.Memories = append(resp.Memories, m)
+		}
+	}
+
+	return resp, nil
+}
+
+func memory(kind, title string, ms []models.Moment) models.Memory {
+	return models.Memory{
+		Kind:    kind,
+		Title:   title,
+		From:    ms[0].TakenAt,
+		To:      ms[len(ms)-1].TakenAt,
+		Count:   len(ms),
+		FileIDs: sample(ms, utils.MEMORY_MAX_FILES),
+	}
+}
+
+// at most n files spread over the whole memory
+func sample(ms []models.Moment, n int) []int {
+	if len(ms) < n {
+		n = len(ms)
+	}
+
+	ids := make([]int, n)
+	for i := range n {
+		ids[i] = ms[i*len(ms)/n].FileID
+	}
+
+	return ids
+}
+
+// one memory per earlier year with photos taken on today's date, latest year first
+func onThisDay(moments []models.Moment, today time.Time) []models.Memory {
+	byYear := make(map[int][]models.Moment)
+	var years []int
+	for _, m := range moments {
+		y := m.TakenAt.Year()
+		if y >= today.Year() || m.TakenAt.Month() != today.Month() || m.TakenAt.Day() != today.Day() {
+			continue
+		}
+
+		if _, ok := byYear[y]; !ok {
+			years = append(years, y)
+		}
+		byYear[y] = append(byYear[y], m)
+	}
+
+	var mems []models.Memory
+	for i := len(years) - 1; i >= 0; i-- {
+		n := today.Year() - years[i]
+
+		title := fmt.Sprintf("%d years ago", n)
+		if n == 1 {
+			title = "1 year ago"
+		}
+
+		mems = append(mems, memory(models.MemoryOnThisDay, title, byYear[years[i]]))
+	}
+
+	return mems
+}
+
+func monthLastYear(moments []models.Moment, today time.Time) []models.Memory {
+	from := time.Date(today.Year()-1, today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	var ms []models.Moment
+	for _, m := range moments {
+		// capture times are wall clock, compare them as such
+		t := time.Date(m.TakenAt.Year(), m.TakenAt.Month(), m.TakenAt.Day(), 0, 0, 0, 0, time.UTC)
+		if !t.Before(from) && t.Before(to) {
+			ms = append(ms, m)
+		}
+	}
+
+	if len(ms) == 0 {
+		return nil
+	}
+
+	return []models.Memory{memory(models.MemoryMonth, from.Format("January 2006"), ms)}
+}
+
+// runs of photos with no gap over TRIP_GAP, spread over a few days and
+// busy enough not to be everyday snapshots
+func trips(moments []models.Moment) []models.Memory {
+	var mems []models.Memory
+
+	start := 0
+	for i := 1; i <= len(moments); i++ {
+		if i < len(moments) && moments[i].TakenAt.Sub(moments[i-1].TakenAt) <= utils.TRIP_GAP {
+			continue
+		}
+
+		run := moments[start:i]
+		start = i
+
+		span := run[len(run)-1].TakenAt.Sub(run[0].TakenAt)
+		if len(run) < utils.TRIP_MIN_FILES || span > utils.TRIP_MAX_SPAN ||
+			run[0].TakenAt.Format(time.DateOnly) == run[len(run)-1].TakenAt.Format(time.DateOnly) {
+			continue
+		}
+
+		mems = append(mems, memory(models.MemoryTrip, tripTitle(run), run))
+	}
+
+	// newest first
+	for i, j := 0, len(mems)-1; i < j; i, j = i+1, j-1 {
+		mems[i], mems[j] = mems[j], mems[i]
+	}
+
+	if len(mems) > utils.MAX_TRIPS {
+		mems = mems[:utils.MAX_TRIPS]
+	}
+
+	return mems
+}
+
+// the most photographed city, or country, of the trip
+func tripTitle(run []models.Moment) string {
+	cities := make(map[models.Place]int)
+	countries := make(map[string]int)
+	var city models.Place
+	var country string
+
+	for _, m := range run {
+		if len(m.City) > 0 {
+			p := models.Place{Country: m.Country, City: m.City}
+			cities[p]++
+			if cities[p] > cities[city] {
+				city = p
+			}
+		}
+
+		if len(m.Country) > 0 {
+			countries[m.Country]++
+			if countries[m.Country] > countries[country] {
+				country = m.Country
+			}
+		}
+	}
+
+	switch {
+	case len(city.City) > 0 && len(city.Country) > 0:
+		return fmt.Sprintf("%s, %s", city.City, city.Country)
+	case len(city.City) > 0:
+		return city.City
+	case len(country) > 0:
+		return country
+	}
+
+	return "Trip"
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+const (
+	RoleOwner       = "owner"
+	RoleEditor      = "editor"      // contributor + renames, trashes and removes any file of the album
+	RoleContributor = "contributor" // viewer + adds own files, uploads into the album
+	RoleViewer      = "viewer"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleContributor: 2, RoleEditor: 3, RoleOwner: 4}
+
+// roles an owner can hand out
+func IsMemberRole(role string) bool {
+	return role == RoleViewer || role == RoleContributor || role == RoleEditor
+}
+
+// role grants at least what min does, false for no role at all
+func RoleAtLeast(role, min string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[min]
+}
+
+type Album struct {
+	ID        int       `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"` // owner
+	Role      string    `json:"role"`                   // of the requesting user
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	FileCount int       `json:"fileCount"`
+	// saved filter of a smart album, its files are whatever matches it now.
+	// nil for albums files are added to by hand
+	Query *FileFilter `json:"query,omitempty" db:"query"`
+}
+
+func (a *Album) IsSmart() bool {
+	return a.Query != nil
+}
+
+type AlbumMember struct {
+	Username string    `json:"username" db:"username"`
+	Role     string    `json:"role" db:"role"`
+	AddedAt  time.Time `json:"addedAt" db:"added_at"`
+}
+
+// DTO ========================================================================
+
+type MemberRequest struct {
+	Username string `json:"username"` // from the path on updates
+	Role     string `json:"role" binding:"required"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type ChangeKind string
+
+const (
+	ChangeFileInsert  ChangeKind = "file.insert"
+	ChangeFileUpdate  ChangeKind = "file.update" // caption, tags
+	ChangeFileRename  ChangeKind = "file.rename"
+	ChangeFileDelete  ChangeKind = "file.delete" // moved to trash
+	ChangeFileRestore ChangeKind = "file.restore"
+	ChangeFilePurge   ChangeKind = "file.purge" // gone for good
+	ChangeFileEdit    ChangeKind = "file.edit"  // rotate, flip ...
+	ChangeFileMove    ChangeKind = "file.move"  // to another folder
+
+	ChangeAlbumCreate ChangeKind = "album.create"
+	ChangeAlbumUpdate ChangeKind = "album.update"
+	ChangeAlbumDelete ChangeKind = "album.delete"
+	ChangeAlbumAdd    ChangeKind = "album.add" // file added to album
+	ChangeAlbumRemove ChangeKind = "album.remove"
+)
+
+type Change struct {
+	ID        int64      `json:"id" db:"id"`
+	Username  string     `json:"-" db:"username"`
+	Kind      ChangeKind `json:"kind" db:"kind"`
+	FileID    int        `json:"fileId,omitempty" db:"file_id"`
+	AlbumID   int        `json:"albumId,omitempty" db:"album_id"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// DTO ========================================================================
+
+type SyncResponse struct {
+	Changes []Change       `json:"changes"`
+	Files   []FileResponse `json:"files"`   // current state of changed files still in the gallery
+	Token   string         `json:"token"`   // pass as ?since= next time
+	HasMore bool           `json:"hasMore"` // call again right away with the new token
+	Resync  bool           `json:"resync"`  // token too old or missing, refetch everything first
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// a hashed image as shown in the duplicate review
+type DuplicateFile struct {
+	ID           int        `json:"id"`
+	OriginalName string     `json:"originalName"`
+	FilePath     string     `json:"filePath"`  // rel path
+	Thumbnail    string     `json:"thumbnail"` // medium, rel path
+	Width        int        `json:"width,omitempty"`
+	Height       int        `json:"height,omitempty"`
+	FileSize     int64      `json:"fileSize"`
+	TakenAt      *time.Time `json:"takenAt,omitempty"`
+	UploadedAt   time.Time  `json:"uploadedAt"`
+	Distance     int        `json:"distance"` // phash bits differing from the suggested copy
+	DHash        uint64     `json:"-"`
+	PHash        uint64     `json:"-"`
+	Paired       bool       `json:"-"` // its duplicate pairs are stored
+}
+
+func (f *DuplicateFile) CapturedAt() time.Time {
+	if f.TakenAt != nil {
+		return *f.TakenAt
+	}
+
+	return f.UploadedAt
+}
+
+// near duplicates found by the hash job, FileA < FileB. Distance is the
+// larger of the dhash and phash distances
+type DuplicatePair struct {
+	FileA    int
+	FileB    int
+	Distance int
+}
+
+// Keep is the suggested copy, highest resolution then earliest capture
+type DuplicateGroup struct {
+	Keep  int             `json:"keep"`
+	Files []DuplicateFile `json:"files"`
+}
+
+// DTO ========================================================================
+
+type DuplicatesResponse struct {
+	Groups   []DuplicateGroup `json:"groups"`
+	Distance int              `json:"distance"`
+}
+
+type TrashRequest struct {
+	FileIDs []int `json:"fileIds" binding:"required"`
+}
+
+type TrashResponse struct {
+	Trashed []int `json:"trashed"` // already trashed and unknown ids are left out
+}
+
+type HashSummary struct {
+	Hashed int `json:"hashed"`
+	Failed int `json:"failed"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+type EditKind string
+
+const (
+	EditRotate EditKind = "rotate" // Angle clockwise, 90, 180 or 270
+	EditFlip   EditKind = "flip"   // Axis horizontal (mirror) or vertical
+	EditCrop   EditKind = "crop"   // X, Y, Width, Height as fractions of the image at that point of the stack
+	EditAdjust EditKind = "adjust" // Brightness, Contrast, Saturation from -100 to 100, 0 keeps it
+	EditFilter EditKind = "filter" // Name is one of EditFilters
+)
+
+var EditFilters = []string{"grayscale", "sepia", "invert", "sharpen", "blur"}
+
+// one step of an edit stack, applied on top of the exif oriented original
+type EditOp struct {
+	Op    EditKind `json:"op"`
+	Angle int      `json:"angle,omitempty"`
+	Axis  string   `json:"axis,omitempty"`
+
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+
+	Brightness float64 `json:"brightness,omitempty"`
+	Contrast   float64 `json:"contrast,omitempty"`
+	Saturation float64 `json:"saturation,omitempty"`
+
+	Name string `json:"name,omitempty"`
+}
+
+func (o EditOp) Valid() bool {
+	inRange := func(v float64) bool { return v >= -100 && v <= 100 }
+
+	switch o.Op {
+	case EditRotate:
+		return o.Angle == 90 || o.Angle == 180 || o.Angle == 270
+	case EditFlip:
+		return o.Axis == "horizontal" || o.Axis == "vertical"
+	case EditCrop:
+		return o.X >= 0 && o.Y >= 0 && o.Width > 0 && o.Height > 0 &&
+			o.X+o.Width <= 1 && o.Y+o.Height <= 1
+	case EditAdjust:
+		return inRange(o.Brightness) && inRange(o.Contrast) && inRange(o.Saturation)
+	case EditFilter:
+		return slices.Contains(EditFilters, o.Name)
+	default:
+		return false
+	}
+}
+
+// videos only get rotated and flipped, the rest is ignored for them
+func (o EditOp) ForVideo() bool {
+	return o.Op == EditRotate || o.Op == EditFlip
+}
+
+// Version goes up with every change, derivative paths include it so
+// immutably cached thumbnails and renditions are never stale
+type FileEdits struct {
+	FileID    int       `json:"fileId" db:"file_id"`
+	Ops       []EditOp  `json:"ops" db:"ops"`
+	Version   int       `json:"version" db:"version"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// DTO ========================================================================
+
+type EditsRequest struct {
+	Ops []EditOp `json:"ops"`
+}
@@ -0,0 +1,44 @@
+package models
+
+type EventKind string
+
+const (
+	EventUploadDone     EventKind = "upload.done"
+	EventThumbnailReady EventKind = "thumbnail.ready"
+	EventVideoReady     EventKind = "video.ready" // hls renditions done
+	EventFileDeleted    EventKind = "file.deleted"
+	EventFileRenamed    EventKind = "file.renamed"
+	EventJobDone        EventKind = "job.done"
+	EventJobFailed      EventKind = "job.failed"
+	EventQuotaWarning   EventKind = "quota.warning"
+)
+
+// pushed to every open /events stream of a user
+type Event struct {
+	Kind EventKind `json:"kind"`
+	Data any       `json:"data"`
+}
+
+// DTO ========================================================================
+
+type FileEvent struct {
+	FileID int    `json:"fileId"`
+	Name   string `json:"name,omitempty"`
+}
+
+type ThumbnailEvent struct {
+	FileID       int    `json:"fileId"`
+	SizeName     string `json:"sizeName"`
+	RelativePath string `json:"relativePath"`
+}
+
+type JobEvent struct {
+	JobID int    `json:"jobId"`
+	Kind  string `json:"kind"`
+	Error string `json:"error,omitempty"`
+}
+
+type QuotaEvent struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// bump when the layout of manifest.json or the sidecars changes
+const ExportVersion = 1
+
+// written next to every original as <name>.json and collected in manifest.json
+type ExportFile struct {
+	Path         string        `json:"path"` // inside the archive
+	ID           int           `json:"id"`
+	OriginalName string        `json:"originalName"`
+	Hash         string        `json:"hash"` // sha256
+	MimeType     string        `json:"mimeType"`
+	FileSize     int64         `json:"fileSize"`
+	UploadedAt   time.Time     `json:"uploadedAt"`
+	TakenAt      *time.Time    `json:"takenAt,omitempty"`
+	Caption      string        `json:"caption,omitempty"`
+	Tags         []string      `json:"tags,omitempty"`
+	Albums       []string      `json:"albums,omitempty"`
+	Metadata     *FileMetadata `json:"metadata,omitempty"`
+}
+
+type ExportAlbum struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Files     []string  `json:"files"` // archive paths
+}
+
+type ExportManifest struct {
+	Version    int           `json:"version"`
+	Username   string        `json:"username"`
+	ExportedAt time.Time     `json:"exportedAt"`
+	Files      []ExportFile  `json:"files"`
+	Albums     []ExportAlbum `json:"albums"`
+	Tags       []Tag         `json:"tags"`
+}
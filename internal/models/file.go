@@ -1,7 +1,9 @@
 package models
 
 import (
+	"fmt"
 	"kmem/internal/utils"
+	"strings"
 	"time"
 )
 
@@ -24,13 +26,17 @@ type File struct {
 	FileSize     int64      `json:"fileSize" db:"file_size"`
 	MimeType     string     `json:"mimeType" db:"mime_type"`
 	UploadedAt   time.Time  `json:"uploadedAt" db:"uploaded_at"`
+	TakenAt      *time.Time `json:"takenAt" db:"taken_at"` // capture time, allow null
+	Caption      string     `json:"caption" db:"caption"`
 	Deleted      bool       `json:"deleted" db:"deleted"`
 	DeletedAt    *time.Time `json:"deletedAt" db:"deleted_at"` // allow null
+	FolderID     *int       `json:"folderId" db:"folder_id"`   // nil at the root
 }
 
 func (f *File) IsImage() bool {
 	switch f.MimeType {
-	case "image/jpeg", "image/jpg", "image/png", "image/gif", "image/webp":
+	case "image/jpeg", "image/jpg", "image/png", "image/gif", "image/webp",
+		"image/heic", "image/heif", "image/x-adobe-dng", "image/x-canon-cr2", "image/x-nikon-nef", "image/x-sony-arw":
 		return true
 	default:
 		return false
@@ -39,7 +45,16 @@ func (f *File) IsImage() bool {
 
 func (f *File) IsVideo() bool {
 	switch f.MimeType {
-	case "video/mp4", "video/avi", "video/mov", "video/mkv", "video/webm":
+	case "video/mp4", "video/avi", "video/mov", "video/quicktime", "video/mkv", "video/x-matroska", "video/webm":
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *File) IsAudio() bool {
+	switch f.MimeType {
+	case "audio/mpeg", "audio/mp4", "audio/flac", "audio/wav", "audio/ogg":
 		return true
 	default:
 		return false
@@ -53,10 +68,22 @@ func (f *File) GetFileType() string {
 	if f.IsVideo() {
 		return "video"
 	}
+	if f.IsAudio() {
+		return "audio"
+	}
 
 	return "other"
 }
 
+// capture time if known, upload time otherwise
+func (f *File) CapturedAt() time.Time {
+	if f.TakenAt != nil {
+		return *f.TakenAt
+	}
+
+	return f.UploadedAt
+}
+
 func (f *File) GetReadableSize() string {
 	return utils.GetReadableSize(f.FileSize)
 
@@ -86,7 +113,7 @@ type FileUploadResponse struct {
 	StoredName   string `json:"storedName"`
 	FileSize     int64  `json:"fileSize"`
 	MimeType     string `json:"mimeType"`
-	FileType     string `json:"fileType"` // "image", "video", "other"
+	FileType     string `json:"fileType"` // "image", "video", "audio", "other"
 }
 
 type FileResponse struct {
@@ -94,7 +121,60 @@ type FileResponse struct {
 	OriginalName string                       `json:"originalName,omitempty"`
 	MimeType     string                       `json:"mimeType,omitempty"`
 	FilePath     string                       `json:"filePath,omitempty"` // rel path
+	Uploader     string                       `json:"uploader,omitempty"` // owner of the file, differs on shared items
 	Thumbnails   map[string]ThumbnailResponse `json:"thumbnails,omitempty"`
+	Stream       string                       `json:"stream,omitempty"` // hls master playlist
+	Renditions   []RenditionResponse          `json:"renditions,omitempty"`
+	Stack        *StackResponse               `json:"stack,omitempty"` // set on the gallery tile of a stack
+}
+
+// what a /static path belongs to
+type StaticEntry struct {
+	FileID       int
+	Hash         string
+	OriginalName string
+	Variant      string // empty for the original, thumbnail size or rendition file otherwise
+	Format       string // of thumbnails
+}
+
+// strong etag, the original's hash plus the variant for derivatives
+func (e *StaticEntry) ETag() string {
+	if len(e.Variant) == 0 {
+		return fmt.Sprintf(`"%s"`, e.Hash)
+	}
+
+	variant := e.Variant
+	if len(e.Format) > 0 {
+		variant += "." + e.Format
+	}
+
+	return fmt.Sprintf(`"%s-%s"`, e.Hash, strings.ReplaceAll(variant, `"`, ""))
+}
+
+// any combination narrows the selection, All selects every file of the user
+type DownloadRequest struct {
+	FileIDs []int      `json:"fileIds"`
+	AlbumID int        `json:"albumId"`
+	From    *time.Time `json:"from"`
+	To      *time.Time `json:"to"`
+	All     bool       `json:"all"`
+}
+
+func (r *DownloadRequest) IsEmpty() bool {
+	return len(r.FileIDs) == 0 && r.AlbumID == 0 && r.From == nil && r.To == nil && !r.All
+}
+
+type HashCheckRequest struct {
+	Files []struct {
+		Hash string `json:"hash" binding:"required,len=64,hexadecimal"` // sha256
+		Size int64  `json:"size"`                                       // optional, checked when > 0
+	} `json:"files" binding:"required,dive"`
+}
+
+type HashCheckResponse struct {
+	Existing []string `json:"existing"`
+	Trashed  []string `json:"trashed"` // uploading restores them
+	Unknown  []string `json:"unknown"`
 }
 
 type FileListResponse struct {
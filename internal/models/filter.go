@@ -0,0 +1,48 @@
+package models
+
+import (
+	"fmt"
+	"kmem/internal/utils"
+	"time"
+)
+
+// which files a gallery view or a smart album shows, zero values don't filter
+type FileFilter struct {
+	Type     string     `json:"type,omitempty"`   // image, video, audio
+	Search   string     `json:"search,omitempty"` // file name, place or audio tags
+	Tags     []string   `json:"tags,omitempty"`   // files need all of them
+	From     *time.Time `json:"from,omitempty"`   // capture time, upload time when unknown
+	To       *time.Time `json:"to,omitempty"`
+	Camera   string     `json:"camera,omitempty"`  // make or model
+	Place    string     `json:"place,omitempty"`   // city, region or country
+	MinSize  int64      `json:"minSize,omitempty"` // bytes
+	MaxSize  int64      `json:"maxSize,omitempty"`
+	Uploader string     `json:"uploader,omitempty"` // account the file was uploaded by
+}
+
+// normalizes tags and checks the ranges
+func (f *FileFilter) Validate() error {
+	switch f.Type {
+	case "", "all", "image", "video", "audio":
+	default:
+		return fmt.Errorf("invalid type: %s", f.Type)
+	}
+
+	if len(f.Tags) > 0 {
+		tags, err := utils.NormalizeTags(f.Tags)
+		if err != nil {
+			return err
+		}
+		f.Tags = tags
+	}
+
+	if f.From != nil && f.To != nil && f.From.After(*f.To) {
+		return fmt.Errorf("from is after to")
+	}
+
+	if f.MinSize < 0 || f.MaxSize < 0 || (f.MaxSize > 0 && f.MinSize > f.MaxSize) {
+		return fmt.Errorf("invalid size range")
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// virtual, files stay where they were stored and only point at their folder
+type Folder struct {
+	ID        int       `json:"id" db:"id"`
+	Username  string    `json:"-" db:"username"`
+	ParentID  *int      `json:"parentId" db:"parent_id"` // nil at the root
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	Size      int64     `json:"size"`      // of every file below, subfolders included
+	FileCount int       `json:"fileCount"` // same
+}
+
+// DTO ========================================================================
+
+type Crumb struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// a row of the folder listing, media and general files alike
+type FolderFile struct {
+	ID           int       `json:"id"`
+	OriginalName string    `json:"originalName"`
+	MimeType     string    `json:"mimeType"`
+	FilePath     string    `json:"filePath"` // rel path
+	FileSize     int64     `json:"fileSize"`
+	UploadedAt   time.Time `json:"uploadedAt"`
+	Thumbnail    string    `json:"thumbnail,omitempty"` // small jpeg, once generated
+}
+
+type FolderResponse struct {
+	Breadcrumb []Crumb      `json:"breadcrumb"` // root first, empty at the root
+	Folders    []Folder     `json:"folders"`
+	Files      []FolderFile `json:"files"`
+	HasNext    bool         `json:"hasNext"`
+	NextPage   int          `json:"nextPage"`
+}
+
+type FolderRequest struct {
+	Name     string `json:"name" binding:"required"`
+	ParentID *int   `json:"parentId"`
+}
+
+type MoveFolderRequest struct {
+	ParentID *int `json:"parentId"` // nil moves to the root
+}
+
+type MoveFilesRequest struct {
+	FileIDs  []int `json:"fileIds" binding:"required"`
+	FolderID *int  `json:"folderId"` // nil moves to the root
+}
@@ -0,0 +1,38 @@
+package models
+
+// reverse geocoded from the coordinates of a file
+type Place struct {
+	Country string `json:"country,omitempty" db:"country"`
+	Region  string `json:"region,omitempty" db:"region"` // state, province...
+	City    string `json:"city,omitempty" db:"city"`
+}
+
+// coordinates of a file
+type Located struct {
+	FileID    int
+	Latitude  float64
+	Longitude float64
+}
+
+// degrees, MinLon > MaxLon when the box crosses the antimeridian
+type BBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// DTO ========================================================================
+
+// files close to each other on the map, shown as one marker
+type GeoCluster struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+	FileID    int     `json:"fileId"`    // latest of the cluster
+	Thumbnail string  `json:"thumbnail"` // small thumbnail of FileID
+}
+
+type GeoResponse struct {
+	Clusters []GeoCluster `json:"clusters"`
+}
@@ -0,0 +1,19 @@
+package models
+
+const (
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+type ImportIssue struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // skipped, failed
+	Reason string `json:"reason"`
+}
+
+type ImportSummary struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`
+	Failed   int           `json:"failed"`
+	Issues   []ImportIssue `json:"issues,omitempty"` // capped, see importer
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+const (
+	JobKindZip    = "zip"
+	JobKindExport = "export"
+	JobKindImport = "import"
+	JobKindHash   = "hash" // perceptual hashes for duplicate review
+)
+
+type Job struct {
+	ID        int             `json:"id" db:"id"`
+	Username  string          `json:"username" db:"username"`
+	Kind      string          `json:"kind" db:"kind"`
+	Status    JobStatus       `json:"status" db:"status"`
+	Progress  int             `json:"progress" db:"progress"`
+	Total     int             `json:"total" db:"total"`
+	FilePath  string          `json:"-" db:"file_path"` // result archive, never exposed
+	Error     string          `json:"error,omitempty" db:"error"`
+	Result    json.RawMessage `json:"result,omitempty" db:"result"` // job specific summary
+	CreatedAt time.Time       `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time       `json:"updatedAt" db:"updated_at"`
+	ExpiresAt *time.Time      `json:"expiresAt,omitempty" db:"expires_at"` // allow null
+}
+
+// DTO ========================================================================
+
+type JobResponse struct {
+	Job
+	DownloadURL string `json:"downloadUrl,omitempty"`
+}
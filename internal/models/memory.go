@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const (
+	MemoryOnThisDay = "on_this_day" // this day N years ago
+	MemoryMonth     = "month"       // this month last year
+	MemoryTrip      = "trip"        // many photos within a few days
+)
+
+// capture time & place of a gallery file, what memories are built from
+type Moment struct {
+	FileID  int
+	TakenAt time.Time
+	Place
+}
+
+// DTO ========================================================================
+
+type Memory struct {
+	Kind    string         `json:"kind"`
+	Title   string         `json:"title"`
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Count   int            `json:"count"`
+	FileIDs []int          `json:"-"`     // sampled from the whole memory
+	Files   []FileResponse `json:"files"` // FileIDs, oldest first
+}
+
+type MemoriesResponse struct {
+	Date     string   `json:"date"` // day the memories were built for
+	Memories []Memory `json:"memories"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// extracted from exif (images) or ffprobe (videos, audio)
+type FileMetadata struct {
+	FileID      int        `json:"fileId" db:"file_id"`
+	TakenAt     *time.Time `json:"takenAt,omitempty" db:"taken_at"` // stored on files
+	Width       int        `json:"width,omitempty" db:"width"`
+	Height      int        `json:"height,omitempty" db:"height"`
+	CameraMake  string     `json:"cameraMake,omitempty" db:"camera_make"`
+	CameraModel string     `json:"cameraModel,omitempty" db:"camera_model"`
+	Orientation int        `json:"orientation,omitempty" db:"orientation"`
+	Latitude    *float64   `json:"latitude,omitempty" db:"latitude"`
+	Longitude   *float64   `json:"longitude,omitempty" db:"longitude"`
+	Duration    float64    `json:"duration,omitempty" db:"duration"` // seconds, videos & audio
+	Place
+	AudioTags
+}
+
+// id3 / vorbis comments of audio files
+type AudioTags struct {
+	Title  string `json:"title,omitempty" db:"title"`
+	Artist string `json:"artist,omitempty" db:"artist"`
+	Album  string `json:"album,omitempty" db:"album"`
+}
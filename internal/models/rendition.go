@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// hls variant of a video, stored as
+//
+//	<user dir>/renditions/<stored name>/master.m3u8
+//	<user dir>/renditions/<stored name>/<name>/index.m3u8
+//	<user dir>/renditions/<stored name>/<name>/seg_000.ts
+type Rendition struct {
+	ID           int       `json:"id" db:"id"`
+	FileID       int       `json:"fileId" db:"file_id"`
+	Name         string    `json:"name" db:"name"` // 360p, 720p, 1080p
+	Width        int       `json:"width" db:"width"`
+	Height       int       `json:"height" db:"height"`
+	Bandwidth    int       `json:"bandwidth" db:"bandwidth"` // bits per second, as in the playlist
+	DirPath      string    `json:"dirPath" db:"dir_path"`
+	RelativePath string    `json:"relativePath" db:"relative_path"` // variant playlist
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+type RenditionResponse struct {
+	Name     string `json:"name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	FilePath string `json:"filePath"`
+}
@@ -14,6 +14,7 @@ const (
 
 	ErrUnauthorized APIErrorCode = "UNAUTHORIZED"
 	ErrInvalidToken APIErrorCode = "INVALID_TOKEN"
+	ErrForbidden    APIErrorCode = "FORBIDDEN"
 
 	ErrValidation   APIErrorCode = "VALIDATION_ERROR"
 	ErrInvalidInput APIErrorCode = "INVALID_INPUT"
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	StackLive   = "live"   // live photo still + its clip
+	StackBurst  = "burst"  // shots seconds apart from one camera
+	StackManual = "manual" // put together by the user
+)
+
+// the gallery shows a stack as its primary file only
+type Stack struct {
+	ID            int       `json:"id" db:"id"`
+	Username      string    `json:"-" db:"username"`
+	Kind          string    `json:"kind" db:"kind"`
+	PrimaryFileID int       `json:"primaryFileId" db:"primary_file_id"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+}
+
+// what auto stacking needs to know about a file
+type StackCandidate struct {
+	ID           int
+	OriginalName string
+	MimeType     string
+	TakenAt      time.Time
+	CameraModel  string
+	StackID      int // 0 when not stacked
+	StackKind    string
+}
+
+// DTO ========================================================================
+
+type StackResponse struct {
+	ID    int    `json:"id"`
+	Kind  string `json:"kind"`
+	Count int    `json:"count"` // members including the primary
+}
+
+type StackRequest struct {
+	FileIDs []int `json:"fileIds"`
+	Primary int   `json:"primary"` // first of FileIDs when 0
+}
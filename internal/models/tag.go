@@ -0,0 +1,8 @@
+package models
+
+type Tag struct {
+	ID        int    `json:"id" db:"id"`
+	Username  string `json:"username" db:"username"`
+	Name      string `json:"name" db:"name"`
+	FileCount int    `json:"fileCount"`
+}
@@ -6,6 +6,7 @@ type Thumbnail struct {
 	ID           int       `json:"id" db:"id"`
 	FileID       int       `json:"fileId" db:"file_id"`
 	SizeName     string    `json:"sizeName" db:"size_name"`
+	Format       string    `json:"format" db:"format"` // jpeg, webp, avif, mp4 - empty for old rows in the original's format
 	Width        int       `json:"width" db:"width"`
 	Height       int       `json:"height" db:"height"`
 	FilePath     string    `json:"filePath" db:"file_path"`
@@ -14,7 +15,23 @@ type Thumbnail struct {
 	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
 }
 
+// besides the stills (small, medium, large) videos have
+//
+//	preview  short muted mp4 stitched from a few points of the clip, meant to loop
+//	sprite   SPRITE_COLUMNS x SPRITE_ROWS grid of evenly spaced keyframes for scrubbing,
+//	         Width/Height are of the whole sheet
+//
+// FilePath is the fallback every browser shows, /static swaps in one of
+// Formats when the Accept header allows
 type ThumbnailResponse struct {
-	SizeName string `json:"sizeName,omitempty"`
-	FilePath string `json:"filePath,omitempty"`
+	SizeName string   `json:"sizeName,omitempty"`
+	FilePath string   `json:"filePath,omitempty"`
+	Width    int      `json:"width,omitempty"`
+	Height   int      `json:"height,omitempty"`
+	Formats  []string `json:"formats,omitempty"`
+}
+
+// encoded next to a fallback thumbnail of the same size
+func IsAlternateFormat(format string) bool {
+	return format == "webp" || format == "avif"
 }
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/memories"
+	"kmem/internal/utils"
+	"log"
+	"time"
+)
+
+// builds the memories of every user for today ahead of the first visit
+type buildMemories struct {
+	pg    *db.Postgres
+	cache *cache.Cache
+}
+
+func BuildMemories(pg *db.Postgres, cache *cache.Cache) *buildMemories {
+	return &buildMemories{
+		pg:    pg,
+		cache: cache,
+	}
+}
+
+func (b *buildMemories) process() error {
+	usernames, err := b.pg.GetUsernames()
+	if err != nil {
+		return err
+	}
+
+	today := time.Now()
+	for _, username := range usernames {
+		resp, err := memories.Build(b.pg, username, today)
+		if err != nil {
+			log.Printf("failed to build memories of %s: %v", username, err)
+			continue
+		}
+
+		b.cache.SetFor(memories.CacheKey(username, today), resp, utils.MEMORIES_CACHE_DUR)
+	}
+
+	return nil
+}
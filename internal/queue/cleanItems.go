@@ -7,9 +7,11 @@ import (
 	"kmem/internal/config"
 	"kmem/internal/db"
 	"kmem/internal/models"
+	"kmem/internal/utils"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -31,7 +33,7 @@ func CleanItems(pg *db.Postgres, conf *config.Config, cache *cache.Cache) *clean
 	return c
 }
 
-func (c *cleanItems) handleDeletedFile(dfile models.DelFile) error {
+func (c *cleanItems) handleDeletedFile(dfile models.DelFile, renditionDir string) error {
 	now := time.Now()
 	if !c.shouldDelete(now, *dfile.DeletedAt) {
 		return nil
@@ -53,6 +55,12 @@ func (c *cleanItems) handleDeletedFile(dfile models.DelFile) error {
 		}
 	}
 
+	if len(renditionDir) > 0 {
+		if err := os.RemoveAll(renditionDir); err != nil {
+			log.Printf("failed to remove renditions %s: %v", renditionDir, err)
+		}
+	}
+
 	return nil
 }
 
@@ -66,7 +74,7 @@ func (c *cleanItems) checkFile(dfile models.DelFile) error {
 	return nil
 }
 
-func (c *cleanItems) checkLocalFiles(dmap map[string]models.DelFile) error {
+func (c *cleanItems) checkLocalFiles(dmap map[string]models.DelFile, renditionDirs map[int]string) error {
 	dbPaths := make(map[string]bool)
 	for filePath, dfile := range dmap {
 		dbPaths[filePath] = true
@@ -77,14 +85,31 @@ func (c *cleanItems) checkLocalFiles(dmap map[string]models.DelFile) error {
 		}
 	}
 
+	// hls segments aren't tracked one by one, whole rendition dirs are
+	skipDirs := make(map[string]bool)
+	for _, dir := range renditionDirs {
+		skipDirs[dir] = true
+	}
+
 	return filepath.WalkDir(c.conf.UploadPath(), func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if d.IsDir() {
+			// .part dirs are transcodes in progress
+			if skipDirs[path] || strings.HasSuffix(path, ".part") {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
+		// imports in progress aren't in the db yet, ones left by a crash go
+		if strings.HasPrefix(d.Name(), utils.IMPORT_TMP_PREFIX) {
+			if info, err := d.Info(); err == nil && time.Since(info.ModTime()) < utils.IMPORT_TMP_DUR {
+				return nil
+			}
+		}
+
 		if !dbPaths[path] {
 			log.Printf("Removing orphaned file: %s", path)
 			if err := os.Remove(path); err != nil {
@@ -96,19 +121,47 @@ func (c *cleanItems) checkLocalFiles(dmap map[string]models.DelFile) error {
 	})
 }
 
+// removes job archives (zip downloads, account exports) past their download window
+func (c *cleanItems) cleanExpiredJobs() error {
+	jobs, err := c.pg.GetExpiredJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if len(job.FilePath) > 0 {
+			if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("failed to remove job archive %s: %v", job.FilePath, err)
+				continue
+			}
+		}
+
+		if err := c.pg.DeleteJob(job.ID); err != nil {
+			log.Printf("failed to delete job %d: %v", job.ID, err)
+		}
+	}
+
+	return nil
+}
+
 func (c *cleanItems) process() error {
 	dmap, err := c.pg.GetAllFilesToCheck()
 	if err != nil {
 		return fmt.Errorf("failed to get files to clean: %v", err)
 	}
 
-	if err := c.checkLocalFiles(dmap); err != nil {
+	renditionDirs, err := c.pg.GetRenditionDirs()
+	if err != nil {
+		return fmt.Errorf("failed to get rendition dirs: %v", err)
+	}
+
+	if err := c.checkLocalFiles(dmap, renditionDirs); err != nil {
 		log.Printf("something wrong while checking local files: %v\n", err)
 	}
 
 	for _, dfile := range dmap {
 		if dfile.Deleted {
-			err := c.handleDeletedFile(dfile)
+			err := c.handleDeletedFile(dfile, renditionDirs[dfile.Id])
 			if err != nil {
 				log.Println(err)
 				continue
@@ -122,6 +175,14 @@ func (c *cleanItems) process() error {
 		}
 	}
 
+	if err := c.cleanExpiredJobs(); err != nil {
+		log.Printf("failed to clean expired jobs: %v\n", err)
+	}
+
+	if err := c.pg.CompactChanges(time.Now().Add(-utils.CHANGE_RETENTION_DUR)); err != nil {
+		log.Printf("failed to compact change log: %v\n", err)
+	}
+
 	// clear gallery cache
 	c.cache.ClearGalleryCache()
 
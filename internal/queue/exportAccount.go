@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"kmem/internal/archive"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// packages every non-deleted original of a user with a manifest and
+// per-file json sidecars
+//
+//	manifest.json
+//	originals/<name>
+//	originals/<name>.json
+type exportAccount struct {
+	pg       *db.Postgres
+	conf     *config.Config
+	bus      *events.Bus
+	jobId    int
+	username string
+	format   string // zip, tar
+}
+
+func ExportAccount(pg *db.Postgres, conf *config.Config, bus *events.Bus, jobId int, username, format string) *exportAccount {
+	return &exportAccount{
+		pg:       pg,
+		conf:     conf,
+		bus:      bus,
+		jobId:    jobId,
+		username: username,
+		format:   format,
+	}
+}
+
+func (e *exportAccount) collect() (models.ExportManifest, []models.File, error) {
+	manifest := models.ExportManifest{
+		Version:    models.ExportVersion,
+		Username:   e.username,
+		ExportedAt: time.Now(),
+	}
+
+	files, err := e.pg.GetFilesForDownload(e.username, models.DownloadRequest{All: true})
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	tagsMap, err := e.pg.GetFileTagsMap(e.username)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	metaMap, err := e.pg.GetFileMetadataMap(e.username)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	albums, err := e.pg.GetAlbums(e.username)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	albumFiles, err := e.pg.GetAlbumFilesMap(e.username)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	manifest.Tags, err = e.pg.GetTags(e.username)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	namer := archive.NewNamer()
+	paths := make(map[int]string) // file id -> archive path
+	fileAlbums := make(map[int][]string)
+
+	for _, album := range albums {
+		for _, fileId := range albumFiles[album.ID] {
+			fileAlbums[fileId] = append(fileAlbums[fileId], album.Name)
+		}
+	}
+
+	for _, f := range files {
+		paths[f.ID] = "originals/" + namer.Unique(f.OriginalName)
+
+		ef := models.ExportFile{
+			Path:         paths[f.ID],
+			ID:           f.ID,
+			OriginalName: f.OriginalName,
+			Hash:         f.Hash,
+			MimeType:     f.MimeType,
+			FileSize:     f.FileSize,
+			UploadedAt:   f.UploadedAt,
+			TakenAt:      f.TakenAt,
+			Caption:      f.Caption,
+			Tags:         tagsMap[f.ID],
+			Albums:       fileAlbums[f.ID],
+		}
+
+		if meta, ok := metaMap[f.ID]; ok {
+			ef.Metadata = &meta
+		}
+
+		manifest.Files = append(manifest.Files, ef)
+	}
+
+	for _, album := range albums {
+		ea := models.ExportAlbum{
+			ID:        album.ID,
+			Name:      album.Name,
+			CreatedAt: album.CreatedAt,
+			Files:     []string{},
+		}
+
+		for _, fileId := range albumFiles[album.ID] {
+			// deleted files are not part of the export
+			if p, ok := paths[fileId]; ok {
+				ea.Files = append(ea.Files, p)
+			}
+		}
+
+		manifest.Albums = append(manifest.Albums, ea)
+	}
+
+	return manifest, files, nil
+}
+
+func (e *exportAccount) build(dst string) error {
+	manifest, files, err := e.collect()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer out.Close()
+
+	aw, err := archive.New(e.format, out)
+	if err != nil {
+		return err
+	}
+
+	// files and manifest.Files share the same order
+	for i, ef := range manifest.Files {
+		if err := aw.AddFile(ef.Path, files[i].FilePath, files[i].CapturedAt()); err != nil {
+			return err
+		}
+
+		sidecar, err := json.MarshalIndent(ef, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal sidecar of %d: %v", ef.ID, err)
+		}
+
+		if err := aw.AddBytes(ef.Path+".json", sidecar, files[i].CapturedAt()); err != nil {
+			return err
+		}
+
+		if err := e.pg.UpdateJobProgress(e.jobId, i+1, len(files)); err != nil {
+			log.Printf("failed to update job %d progress: %v", e.jobId, err)
+		}
+	}
+
+	mb, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+
+	if err := aw.AddBytes("manifest.json", mb, manifest.ExportedAt); err != nil {
+		return err
+	}
+
+	if err := aw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+
+	return out.Close()
+}
+
+func (e *exportAccount) process() error {
+	dir := filepath.Join(e.conf.ExportPath(), e.username)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		failJob(e.pg, e.bus, e.username, e.jobId, models.JobKindExport, err)
+		return fmt.Errorf("failed to create export directory: %v", err)
+	}
+
+	dst := filepath.Join(dir, fmt.Sprintf("%d-takeout.%s", e.jobId, e.format))
+	tmp := dst + ".part"
+
+	if err := e.build(tmp); err != nil {
+		os.Remove(tmp)
+		failJob(e.pg, e.bus, e.username, e.jobId, models.JobKindExport, err)
+		return fmt.Errorf("export job %d: %v", e.jobId, err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		failJob(e.pg, e.bus, e.username, e.jobId, models.JobKindExport, err)
+		return fmt.Errorf("export job %d: %v", e.jobId, err)
+	}
+
+	// picked up by cleanItems once expired
+	if err := e.pg.FinishJob(e.jobId, dst, time.Now().Add(utils.EXPORT_RESULT_DUR)); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("export job %d: %v", e.jobId, err)
+	}
+
+	doneJob(e.bus, e.username, e.jobId, models.JobKindExport)
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"fmt"
+	"image"
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/geo"
+	"kmem/internal/media"
+	"kmem/internal/models"
+	"os"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+type extractMetadata struct {
+	pg       *db.Postgres
+	cache    *cache.Cache
+	geocoder *geo.Geocoder // nil when no dataset is configured
+	file     models.File
+}
+
+func ExtractMetadata(pg *db.Postgres, cache *cache.Cache, geocoder *geo.Geocoder, file models.File) *extractMetadata {
+	return &extractMetadata{
+		pg:       pg,
+		cache:    cache,
+		geocoder: geocoder,
+		file:     file,
+	}
+}
+
+func (e extractMetadata) processImage() (models.FileMetadata, error) {
+	meta := models.FileMetadata{FileID: e.file.ID}
+
+	ex, err := media.ReadExif(e.file.FilePath)
+	if err == nil {
+		meta.TakenAt = ex.TakenAt
+		meta.Width = ex.Width
+		meta.Height = ex.Height
+		meta.CameraMake = ex.Make
+		meta.CameraModel = ex.Model
+		meta.Orientation = ex.Orientation
+		meta.Latitude = ex.Latitude
+		meta.Longitude = ex.Longitude
+	}
+
+	// screenshots & edited files usually have no exif dimensions
+	if meta.Width == 0 || meta.Height == 0 {
+		f, err := os.Open(e.file.FilePath)
+		if err != nil {
+			return meta, fmt.Errorf("failed to open %s: %v", e.file.FilePath, err)
+		}
+		defer f.Close()
+
+		if cfg, _, err := image.DecodeConfig(f); err == nil {
+			meta.Width = cfg.Width
+			meta.Height = cfg.Height
+		}
+	}
+
+	return meta, nil
+}
+
+func (e extractMetadata) processVideo() (models.FileMetadata, error) {
+	meta := models.FileMetadata{FileID: e.file.ID}
+
+	p, err := media.ProbeVideo(e.file.FilePath)
+	if err != nil {
+		return meta, err
+	}
+
+	meta.TakenAt = p.TakenAt
+	meta.Width = p.Width
+	meta.Height = p.Height
+	meta.Duration = p.Duration
+	meta.Latitude = p.Latitude
+	meta.Longitude = p.Longitude
+
+	return meta, nil
+}
+
+func (e extractMetadata) processAudio() (models.FileMetadata, error) {
+	meta := models.FileMetadata{FileID: e.file.ID}
+
+	p, err := media.ProbeAudio(e.file.FilePath)
+	if err != nil {
+		return meta, err
+	}
+
+	meta.TakenAt = p.TakenAt
+	meta.Duration = p.Duration
+	meta.Title = p.Title
+	meta.Artist = p.Artist
+	meta.Album = p.Album
+
+	return meta, nil
+}
+
+func (e extractMetadata) process() error {
+	var meta models.FileMetadata
+	var err error
+
+	switch {
+	case strings.Contains(e.file.MimeType, "image"):
+		meta, err = e.processImage()
+	case strings.Contains(e.file.MimeType, "video"):
+		meta, err = e.processVideo()
+	case strings.Contains(e.file.MimeType, "audio"):
+		meta, err = e.processAudio()
+	default:
+		return fmt.Errorf("extract metadata: unsupported type: %s", e.file.MimeType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("extract metadata: %d: %v", e.file.ID, err)
+	}
+
+	if err := e.pg.UpsertFileMetadata(meta); err != nil {
+		return err
+	}
+
+	// the location may also come from an import sidecar, so it's read back
+	if e.geocoder != nil {
+		loc, ok, err := e.pg.GetLocation(e.file.ID)
+		if err != nil {
+			return fmt.Errorf("extract metadata: %v", err)
+		}
+		if ok {
+			if err := placeFile(e.pg, e.geocoder, loc); err != nil {
+				return fmt.Errorf("extract metadata: %v", err)
+			}
+		}
+	}
+
+	// stacking goes by capture time, known only now
+	stacked, err := stackFile(e.pg, e.file.Username, e.file.ID)
+	if err != nil {
+		return fmt.Errorf("extract metadata: %d: failed to stack: %v", e.file.ID, err)
+	}
+	if stacked {
+		e.cache.InvalidateUserGallery(e.file.Username)
+	}
+
+	return nil
+}
@@ -2,9 +2,13 @@ package queue
 
 import (
 	"fmt"
+	"image"
 	"kmem/internal/config"
 	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/media"
 	"kmem/internal/models"
+	"kmem/internal/utils"
 	"log"
 	"os"
 	"os/exec"
@@ -20,14 +24,30 @@ type thumbnailSize struct {
 	height int
 }
 
+// renders and saves the thumbnails of a file
+type previewer func(g genThumbnail) error
+
+// previewers by mime type, "<family>/*" covers a whole family. types
+// without one get a generic icon
+var previewers = map[string]previewer{
+	"image/*":          genThumbnail.processImage,
+	"video/*":          genThumbnail.processVideo,
+	"audio/*":          genThumbnail.processAudio,
+	"application/pdf":  genThumbnail.processPdf,
+	"text/*":           genThumbnail.processText,
+	"application/json": genThumbnail.processText,
+}
+
 type genThumbnail struct {
-	ts   []thumbnailSize
-	file models.File
-	pg   *db.Postgres
-	conf *config.Config
+	ts    []thumbnailSize
+	file  models.File
+	edits models.FileEdits // loaded when processed, edits can change while queued
+	pg    *db.Postgres
+	conf  *config.Config
+	bus   *events.Bus
 }
 
-func GenThumbnail(pg *db.Postgres, conf *config.Config, file models.File) *genThumbnail {
+func GenThumbnail(pg *db.Postgres, conf *config.Config, bus *events.Bus, file models.File) *genThumbnail {
 	return &genThumbnail{
 		ts: []thumbnailSize{
 			{name: "small", width: 150, height: 150},
@@ -37,6 +57,7 @@ func GenThumbnail(pg *db.Postgres, conf *config.Config, file models.File) *genTh
 		file: file,
 		pg:   pg,
 		conf: conf,
+		bus:  bus,
 	}
 }
 
@@ -69,11 +90,9 @@ func (g genThumbnail) processVideo() error {
 	seekTime := max(5, dur*0.3)
 
 	for _, ts := range g.ts {
-		thumbnailDir := filepath.Join(filepath.Dir(g.file.FilePath), "thumbnails", ts.name)
-		thumbnailPath := filepath.Join(thumbnailDir, g.file.StoredName+".jpg")
-
-		if err := os.MkdirAll(thumbnailDir, 0755); err != nil {
-			log.Printf("error creating %s thumbnail directory: %v\n", ts.name, err)
+		thumbnailPath, err := g.derivativePath(ts.name, ".jpg")
+		if err != nil {
+			log.Println(err)
 			continue
 		}
 
@@ -81,8 +100,8 @@ func (g genThumbnail) processVideo() error {
 			"-i", g.file.FilePath,
 			"-ss", fmt.Sprintf("%.1f", seekTime),
 			"-vframes", "1",
-			"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2",
-				ts.width, ts.height, ts.width, ts.height),
+			"-vf", g.videoFilter(fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2",
+				ts.width, ts.height, ts.width, ts.height)),
 			"-y",
 			thumbnailPath,
 		)
@@ -92,90 +111,389 @@ func (g genThumbnail) processVideo() error {
 			continue
 		}
 
-		info, err := os.Stat(thumbnailPath)
-		if err != nil {
-			os.Remove(thumbnailPath)
-			log.Printf("failed to stat thumbnail: %v\n", err)
+		// padded to the box, so the box is the actual size
+		if err := g.save(ts.name, "jpeg", ts.width, ts.height, thumbnailPath); err != nil {
+			log.Println(err)
 			continue
 		}
 
-		relPath := "/static" + strings.TrimPrefix(thumbnailPath, g.conf.UploadPath())
-		err = g.pg.InsertThumbnails(models.Thumbnail{
-			FileID:       g.file.ID,
-			SizeName:     ts.name,
-			Width:        ts.width,
-			Height:       ts.height,
-			FilePath:     thumbnailPath,
-			RelativePath: relPath,
-			FileSize:     info.Size(),
-		})
+		if len(g.conf.ImageFormats()) > 0 {
+			still, err := imaging.Open(thumbnailPath)
+			if err != nil {
+				log.Printf("error opening %s thumbnail: %v\n", ts.name, err)
+				continue
+			}
+
+			g.saveAlternates(ts.name, still, strings.TrimSuffix(thumbnailPath, ".jpg"))
+		}
+	}
+
+	if err := g.genPreview(dur); err != nil {
+		log.Printf("error creating preview of %d: %v\n", g.file.ID, err)
+	}
+
+	if err := g.genSprite(dur); err != nil {
+		log.Printf("error creating sprite of %d: %v\n", g.file.ID, err)
+	}
+
+	return nil
+}
+
+// registers a generated derivative as a thumbnails row, removes it on failure
+func (g genThumbnail) save(sizeName, format string, width, height int, thumbnailPath string) error {
+	info, err := os.Stat(thumbnailPath)
+	if err != nil {
+		os.Remove(thumbnailPath)
+		return fmt.Errorf("failed to stat %s: %v", sizeName, err)
+	}
+
+	relPath := "/static" + strings.TrimPrefix(thumbnailPath, g.conf.UploadPath())
+	err = g.pg.InsertThumbnails(models.Thumbnail{
+		FileID:       g.file.ID,
+		SizeName:     sizeName,
+		Format:       format,
+		Width:        width,
+		Height:       height,
+		FilePath:     thumbnailPath,
+		RelativePath: relPath,
+		FileSize:     info.Size(),
+	})
+	if err != nil {
+		os.Remove(thumbnailPath)
+		return fmt.Errorf("failed to save %s to db: %v", sizeName, err)
+	}
+
+	// clients only ever see the fallback path
+	if !models.IsAlternateFormat(format) {
+		g.notify(sizeName, relPath)
+	}
+
+	return nil
+}
+
+// webp/avif copies of a thumbnail next to its jpeg, base is the path without extension
+func (g genThumbnail) saveAlternates(sizeName string, img image.Image, base string) {
+	b := img.Bounds()
+
+	for _, format := range g.conf.ImageFormats() {
+		if !models.IsAlternateFormat(format) {
+			continue
+		}
+
+		dst := base + media.Extensions[format]
+
+		var err error
+		if format == "webp" && g.file.MimeType == "image/gif" && g.keepsAnimation() {
+			err = media.AnimatedWebp(g.file.FilePath, dst, b.Dx(), b.Dy(), g.edits.Ops)
+		} else {
+			err = media.EncodeFile(dst, img, format)
+		}
 
 		if err != nil {
-			os.Remove(thumbnailPath)
-			log.Printf("failed to save thumbnail to db: %v\n", err)
+			log.Printf("error encoding %s %s thumbnail: %v\n", sizeName, format, err)
 			continue
 		}
+
+		if err := g.save(sizeName, format, b.Dx(), b.Dy(), dst); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (g genThumbnail) derivativePath(sizeName, ext string) (string, error) {
+	dir := filepath.Join(filepath.Dir(g.file.FilePath), "thumbnails", sizeName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating %s directory: %v", sizeName, err)
+	}
+
+	return filepath.Join(dir, g.baseName()+ext), nil
+}
+
+// derivatives are cached as immutable, so edited files get new names
+func (g genThumbnail) baseName() string {
+	if g.edits.Version == 0 {
+		return g.file.StoredName
+	}
+
+	return fmt.Sprintf("%s.v%d", g.file.StoredName, g.edits.Version)
+}
+
+// ffmpeg can only rotate and flip animated gifs, crops and adjustments make them still
+func (g genThumbnail) keepsAnimation() bool {
+	for _, op := range g.edits.Ops {
+		if !op.ForVideo() {
+			return false
+		}
 	}
 
-	return nil
+	return true
+}
+
+// vf with the edits in front
+func (g genThumbnail) videoFilter(vf string) string {
+	if ef := media.EditFilter(g.edits.Ops); len(ef) > 0 {
+		return ef + "," + vf
+	}
+
+	return vf
+}
+
+// a few short clips from across the video stitched into one muted mp4,
+// short videos are used whole
+func (g genThumbnail) genPreview(dur float64) error {
+	p, err := media.ProbeVideo(g.file.FilePath)
+	if err != nil {
+		return err
+	}
+
+	dispW, dispH := p.DisplaySize()
+	srcW, srcH := media.EditedSize(dispW, dispH, g.edits.Ops)
+	if srcW == 0 || srcH == 0 {
+		return fmt.Errorf("no video stream")
+	}
+	w, h := scaledSize(srcW, srcH, 180)
+
+	previewPath, err := g.derivativePath("preview", ".mp4")
+	if err != nil {
+		return err
+	}
+
+	clips := utils.PREVIEW_CLIPS
+	if dur < float64(clips)*utils.PREVIEW_CLIP_DUR*2 {
+		clips = 1
+	}
+
+	var args []string
+	var filter strings.Builder
+	for i := range clips {
+		start := 0.0
+		clipDur := min(dur, float64(utils.PREVIEW_CLIPS)*utils.PREVIEW_CLIP_DUR)
+		if clips > 1 {
+			// 10%, 30%, 50%, 70% ... of the clip
+			start = dur * (0.1 + 0.8*float64(i)/float64(clips))
+			clipDur = utils.PREVIEW_CLIP_DUR
+		}
+
+		args = append(args,
+			"-ss", fmt.Sprintf("%.2f", start),
+			"-t", fmt.Sprintf("%.2f", clipDur),
+			"-i", g.file.FilePath,
+		)
+		fmt.Fprintf(&filter, "[%d:v]%s[v%d];", i, g.videoFilter(fmt.Sprintf("scale=%d:%d,setsar=1,fps=15", w, h)), i)
+	}
+	for i := range clips {
+		fmt.Fprintf(&filter, "[v%d]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=1:a=0[out]", clips)
+
+	args = append(args,
+		"-filter_complex", filter.String(),
+		"-map", "[out]",
+		"-an",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "28",
+		"-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		"-y",
+		previewPath,
+	)
+
+	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(previewPath)
+		return fmt.Errorf("ffmpeg preview: %v: %s", err, lastLine(out))
+	}
+
+	return g.save("preview", "mp4", w, h, previewPath)
+}
+
+// evenly spaced keyframes tiled into one jpeg
+func (g genThumbnail) genSprite(dur float64) error {
+	spritePath, err := g.derivativePath("sprite", ".jpg")
+	if err != nil {
+		return err
+	}
+
+	tiles := utils.SPRITE_COLUMNS * utils.SPRITE_ROWS
+	cmd := exec.Command("ffmpeg",
+		"-skip_frame", "nokey", // decoding keyframes only is way faster
+		"-i", g.file.FilePath,
+		"-vf", g.videoFilter(fmt.Sprintf("fps=%f,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+			float64(tiles)/max(dur, 1),
+			utils.SPRITE_TILE_W, utils.SPRITE_TILE_H, utils.SPRITE_TILE_W, utils.SPRITE_TILE_H,
+			utils.SPRITE_COLUMNS, utils.SPRITE_ROWS)),
+		"-frames:v", "1",
+		"-y",
+		spritePath,
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(spritePath)
+		return fmt.Errorf("ffmpeg sprite: %v: %s", err, lastLine(out))
+	}
+
+	return g.save("sprite", "jpeg", utils.SPRITE_COLUMNS*utils.SPRITE_TILE_W, utils.SPRITE_ROWS*utils.SPRITE_TILE_H, spritePath)
 }
 
 func (g genThumbnail) processImage() error {
-	src, err := imaging.Open(g.file.FilePath)
+	src, err := media.DecodeImage(g.file.FilePath, g.file.MimeType)
 	if err != nil {
-		return fmt.Errorf("error opening: %v\n", err)
+		return fmt.Errorf("error opening: %w", err)
+	}
+	src = media.ApplyEdits(src, g.edits.Ops)
+
+	sizes := g.ts
+	if media.NeedsDisplay(g.file.MimeType) {
+		// full view for heic & raw, browsers can't show the original
+		sizes = append(sizes, thumbnailSize{name: "display", width: 2560, height: 2560})
+	}
+
+	g.saveStills(src, sizes)
+
+	return nil
+}
+
+func (g genThumbnail) processPdf() error {
+	page, err := media.RenderPdf(g.file.FilePath, 1600)
+	if err != nil {
+		return err
+	}
+
+	g.saveStills(page, g.ts)
+
+	return nil
+}
+
+func (g genThumbnail) processText() error {
+	page, err := media.RenderText(g.file.FilePath)
+	if err != nil {
+		return err
+	}
+
+	g.saveStills(page, g.ts)
+
+	return nil
+}
+
+// waveform pngs, drawn once and scaled down, plus the embedded cover art
+func (g genThumbnail) processAudio() error {
+	wave, err := media.Waveform(g.file.FilePath, 800, 400)
+	if err != nil {
+		return err
 	}
 
 	for _, ts := range g.ts {
-		thumbnail := imaging.Fit(src, ts.width, ts.height, imaging.Lanczos)
-		thumbnailDir := filepath.Join(filepath.Dir(g.file.FilePath), "thumbnails", ts.name)
-		thumbnailPath := filepath.Join(thumbnailDir, g.file.StoredName)
-		relPath := "/static" + strings.TrimPrefix(thumbnailPath, g.conf.UploadPath())
+		thumbnail := imaging.Fit(wave, ts.width, ts.height, imaging.Lanczos)
+		b := thumbnail.Bounds()
 
-		if err := os.MkdirAll(thumbnailDir, 0755); err != nil {
-			log.Printf("error creating %s thumbnail directory: %v\n", ts.name, err)
+		thumbnailPath, err := g.derivativePath(ts.name, ".png")
+		if err != nil {
+			log.Println(err)
 			continue
 		}
 
-		if err := imaging.Save(thumbnail, thumbnailPath); err != nil {
-			log.Printf("error saving %s thumbnail: %v\n", ts.name, err)
+		// png keeps the background transparent
+		if err := media.EncodeFile(thumbnailPath, thumbnail, "png"); err != nil {
+			log.Printf("error saving %s waveform: %v\n", ts.name, err)
 			continue
 		}
 
-		info, err := os.Stat(thumbnailPath)
+		if err := g.save(ts.name, "png", b.Dx(), b.Dy(), thumbnailPath); err != nil {
+			log.Println(err)
+		}
+	}
+
+	p, err := media.ProbeAudio(g.file.FilePath)
+	if err != nil || !p.HasCover {
+		return nil
+	}
+
+	cover, err := media.CoverArt(g.file.FilePath)
+	if err != nil {
+		log.Printf("error extracting cover of %d: %v\n", g.file.ID, err)
+		return nil
+	}
+
+	g.saveStills(cover, []thumbnailSize{{name: "cover", width: 800, height: 800}})
+
+	return nil
+}
+
+// generic icon with the extension on it
+func (g genThumbnail) processIcon() error {
+	label := strings.TrimPrefix(filepath.Ext(g.file.OriginalName), ".")
+	if len(label) == 0 {
+		label = "file"
+	}
+
+	g.saveStills(media.Icon(label), g.ts)
+
+	return nil
+}
+
+// jpeg thumbnails, plus alternates, of a still for every size
+func (g genThumbnail) saveStills(src image.Image, sizes []thumbnailSize) {
+	for _, ts := range sizes {
+		thumbnail := imaging.Fit(src, ts.width, ts.height, imaging.Lanczos)
+		b := thumbnail.Bounds()
+
+		base, err := g.derivativePath(ts.name, "")
 		if err != nil {
-			log.Printf("failed to stat thumbnail: %v\n", err)
-			os.Remove(thumbnailPath)
+			log.Println(err)
 			continue
 		}
 
-		err = g.pg.InsertThumbnails(models.Thumbnail{
-			FileID:       g.file.ID,
-			SizeName:     ts.name,
-			Width:        ts.width,
-			Height:       ts.height,
-			FilePath:     thumbnailPath,
-			RelativePath: relPath,
-			FileSize:     info.Size(),
-		})
-		if err != nil {
-			log.Printf("failed to save thumbnail to db: %v\n", err)
-			os.Remove(thumbnailPath)
+		// jpeg whatever the original was, png screenshots make huge thumbnails
+		thumbnailPath := base + ".jpg"
+		if err := media.EncodeFile(thumbnailPath, thumbnail, "jpeg"); err != nil {
+			log.Printf("error saving %s thumbnail: %v\n", ts.name, err)
 			continue
 		}
+
+		if err := g.save(ts.name, "jpeg", b.Dx(), b.Dy(), thumbnailPath); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		g.saveAlternates(ts.name, thumbnail, base)
 	}
+}
 
-	return nil
+func (g genThumbnail) notify(sizeName, relPath string) {
+	g.bus.Publish(g.file.Username, models.EventThumbnailReady, models.ThumbnailEvent{
+		FileID:       g.file.ID,
+		SizeName:     sizeName,
+		RelativePath: relPath,
+	})
 }
 
 func (g genThumbnail) process() error {
-	if strings.Contains(g.file.MimeType, "image") {
-		return g.processImage()
+	edits, err := g.pg.GetFileEdits(g.file.ID)
+	if err != nil {
+		return fmt.Errorf("gen thumbnail: %v", err)
 	}
+	g.edits = edits
+
+	p := previewerFor(g.file.MimeType)
+	if p == nil {
+		return g.processIcon()
+	}
+
+	// missing tools or unreadable files still get a tile
+	if err := p(g); err != nil {
+		log.Printf("gen thumbnail: %d: %v, using an icon\n", g.file.ID, err)
+		return g.processIcon()
+	}
+
+	return nil
+}
 
-	if strings.Contains(g.file.MimeType, "video") {
-		return g.processVideo()
+// exact type first, then the "<family>/*" entry, nil when there is none
+func previewerFor(mimeType string) previewer {
+	if p, ok := previewers[mimeType]; ok {
+		return p
 	}
 
-	return fmt.Errorf("gen thumbnail: unsupported type: %s", g.file.MimeType)
+	family, _, _ := strings.Cut(mimeType, "/")
+	return previewers[family+"/*"]
 }
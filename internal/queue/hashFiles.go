@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"fmt"
+	"kmem/internal/db"
+	"kmem/internal/dedupe"
+	"kmem/internal/events"
+	"kmem/internal/media"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// perceptual hashes of every image of a user that has none yet, from the
+// medium thumbnail so no original has to be decoded. the new hashes are then
+// compared to all others once and the near duplicates stored
+type hashFiles struct {
+	pg       *db.Postgres
+	bus      *events.Bus
+	jobId    int
+	username string
+}
+
+func HashFiles(pg *db.Postgres, bus *events.Bus, jobId int, username string) *hashFiles {
+	return &hashFiles{
+		pg:       pg,
+		bus:      bus,
+		jobId:    jobId,
+		username: username,
+	}
+}
+
+func (h *hashFiles) process() error {
+	thumbs, err := h.pg.GetThumbnailsToHash(h.username)
+	if err != nil {
+		failJob(h.pg, h.bus, h.username, h.jobId, models.JobKindHash, err)
+		return fmt.Errorf("hash job %d: %v", h.jobId, err)
+	}
+
+	var summary models.HashSummary
+	for i, t := range thumbs {
+		img, err := imaging.Open(t.FilePath)
+		if err != nil {
+			log.Printf("failed to open thumbnail of %d: %v", t.FileID, err)
+			summary.Failed++
+			continue
+		}
+
+		if err := h.pg.UpsertFileHash(t.FileID, media.DHash(img), media.PHash(img)); err != nil {
+			log.Println(err)
+			summary.Failed++
+			continue
+		}
+		summary.Hashed++
+
+		if (i+1)%100 == 0 {
+			if err := h.pg.UpdateJobProgress(h.jobId, i+1, len(thumbs)); err != nil {
+				log.Printf("failed to update job %d progress: %v", h.jobId, err)
+			}
+		}
+	}
+
+	if err := h.pairDuplicates(); err != nil {
+		failJob(h.pg, h.bus, h.username, h.jobId, models.JobKindHash, err)
+		return fmt.Errorf("hash job %d: %v", h.jobId, err)
+	}
+
+	if err := h.pg.FinishJobResult(h.jobId, summary, time.Now().Add(utils.JOB_RESULT_DUR)); err != nil {
+		return fmt.Errorf("hash job %d: %v", h.jobId, err)
+	}
+
+	doneJob(h.bus, h.username, h.jobId, models.JobKindHash)
+
+	return nil
+}
+
+// compares files hashed since the last run, or before pairs were stored, to
+// all others
+func (h *hashFiles) pairDuplicates() error {
+	all, err := h.pg.GetHashedFiles(h.username)
+	if err != nil {
+		return err
+	}
+
+	var fresh []models.DuplicateFile
+	var ids []int
+	for _, f := range all {
+		if !f.Paired {
+			fresh = append(fresh, f)
+			ids = append(ids, f.ID)
+		}
+	}
+
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	return h.pg.SaveDuplicatePairs(ids, dedupe.Pairs(fresh, all, utils.MAX_DUPLICATE_DISTANCE))
+}
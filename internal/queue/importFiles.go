@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"fmt"
+	"kmem/internal/cache"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/geo"
+	"kmem/internal/importer"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"time"
+)
+
+type importFiles struct {
+	pg       *db.Postgres
+	conf     *config.Config
+	cache    *cache.Cache
+	bus      *events.Bus
+	geocoder *geo.Geocoder
+	q        *Queue
+	jobId    int
+	owner    string // started the job and follows its events
+	username string // owner of the imported files
+	src      string
+}
+
+func ImportFiles(pg *db.Postgres, conf *config.Config, cache *cache.Cache, bus *events.Bus, geocoder *geo.Geocoder, q *Queue, jobId int, owner, username, src string) *importFiles {
+	return &importFiles{
+		pg:       pg,
+		conf:     conf,
+		cache:    cache,
+		bus:      bus,
+		geocoder: geocoder,
+		q:        q,
+		jobId:    jobId,
+		owner:    owner,
+		username: username,
+		src:      src,
+	}
+}
+
+func (i *importFiles) process() error {
+	// this item holds a worker, a single feeder waits for the others instead
+	// and slows the import down when they fall behind
+	inserted := make(chan models.File, utils.IMPORT_FEED_SIZE)
+	defer close(inserted)
+
+	go func() {
+		for file := range inserted {
+			i.q.Add(GenThumbnail(i.pg, i.conf, i.bus, file))
+			i.q.Add(ExtractMetadata(i.pg, i.cache, i.geocoder, file))
+			if file.IsVideo() {
+				i.q.Add(TranscodeVideo(i.pg, i.conf, i.cache, i.bus, file))
+			}
+		}
+	}()
+
+	im := importer.New(i.pg, i.conf, func(file models.File) {
+		inserted <- file
+	})
+
+	summary, err := im.Run(i.username, i.src, func(done, total int) {
+		// every file would be a lot of writes for big imports
+		if done%20 != 0 && done != total {
+			return
+		}
+
+		if err := i.pg.UpdateJobProgress(i.jobId, done, total); err != nil {
+			log.Printf("failed to update job %d progress: %v", i.jobId, err)
+		}
+	})
+	i.cache.InvalidateUserGallery(i.username)
+
+	if err != nil {
+		failJob(i.pg, i.bus, i.owner, i.jobId, models.JobKindImport, err)
+		return fmt.Errorf("import job %d: %v", i.jobId, err)
+	}
+
+	if err := i.pg.FinishJobResult(i.jobId, summary, time.Now().Add(utils.JOB_RESULT_DUR)); err != nil {
+		return fmt.Errorf("import job %d: %v", i.jobId, err)
+	}
+
+	doneJob(i.bus, i.owner, i.jobId, models.JobKindImport)
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package queue
+
+import (
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"log"
+)
+
+// marks the job failed and lets the owner know right away
+func failJob(pg *db.Postgres, bus *events.Bus, username string, jobId int, kind string, err error) {
+	if ferr := pg.FailJob(jobId, err); ferr != nil {
+		log.Printf("failed to mark job %d failed: %v", jobId, ferr)
+	}
+
+	bus.Publish(username, models.EventJobFailed, models.JobEvent{JobID: jobId, Kind: kind, Error: err.Error()})
+}
+
+func doneJob(bus *events.Bus, username string, jobId int, kind string) {
+	bus.Publish(username, models.EventJobDone, models.JobEvent{JobID: jobId, Kind: kind})
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"fmt"
+	"kmem/internal/db"
+	"kmem/internal/geo"
+	"kmem/internal/models"
+	"log"
+)
+
+func placeFile(pg *db.Postgres, geocoder *geo.Geocoder, loc models.Located) error {
+	place, _ := geocoder.Lookup(loc.Latitude, loc.Longitude)
+	return pg.SetPlace(loc.FileID, place)
+}
+
+// looks up the place of files located before geocoding was set up
+type placeFiles struct {
+	pg       *db.Postgres
+	geocoder *geo.Geocoder
+}
+
+func PlaceFiles(pg *db.Postgres, geocoder *geo.Geocoder) *placeFiles {
+	return &placeFiles{
+		pg:       pg,
+		geocoder: geocoder,
+	}
+}
+
+func (p *placeFiles) process() error {
+	locs, err := p.pg.GetUnplacedFiles()
+	if err != nil {
+		return fmt.Errorf("place files: %v", err)
+	}
+
+	for _, loc := range locs {
+		if err := placeFile(p.pg, p.geocoder, loc); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if len(locs) > 0 {
+		log.Printf("placed %d files", len(locs))
+	}
+
+	return nil
+}
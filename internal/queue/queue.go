@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"log"
 	"sync"
 )
 
@@ -9,6 +10,7 @@ type Queue struct {
 	ctx     context.Context
 	list    chan item
 	workers int
+	pending sync.WaitGroup
 }
 
 func New(ctx context.Context) *Queue {
@@ -36,8 +38,10 @@ func (q *Queue) run() {
 				case <-q.ctx.Done():
 					return
 				case it := <-q.list:
-					it.process()
-					// handle list items
+					if err := it.process(); err != nil {
+						log.Println(err)
+					}
+					q.pending.Done()
 				}
 			}
 		}()
@@ -47,5 +51,11 @@ func (q *Queue) run() {
 }
 
 func (q *Queue) Add(item item) {
+	q.pending.Add(1)
 	q.list <- item
 }
+
+// blocks until every added item is processed, for one-shot runs like the cli
+func (q *Queue) Wait() {
+	q.pending.Wait()
+}
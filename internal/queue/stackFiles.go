@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"fmt"
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cameras write exif time as local time and quicktime time as utc,
+// so the halves of a live photo can be whole time zones apart
+const maxZoneOffset = 14 * time.Hour
+
+func isStill(c models.StackCandidate) bool {
+	return strings.HasPrefix(c.MimeType, "image/")
+}
+
+func isClip(c models.StackCandidate) bool {
+	return strings.HasPrefix(c.MimeType, "video/")
+}
+
+func baseName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// a and b within the window, allowing for time zone offsets (multiples of 15 minutes)
+func sameMoment(a, b time.Time, window time.Duration) bool {
+	d := a.Sub(b).Abs()
+	if d > maxZoneOffset+window {
+		return false
+	}
+
+	rem := d % (15 * time.Minute)
+	return rem <= window || 15*time.Minute-rem <= window
+}
+
+// IMG_1234.HEIC + IMG_1234.MOV
+func stackLivePhoto(pg *db.Postgres, username string, f models.StackCandidate) (bool, error) {
+	if f.StackID != 0 || (!isStill(f) && !isClip(f)) {
+		return false, nil
+	}
+
+	near, err := pg.GetStackCandidatesBetween(username,
+		f.TakenAt.Add(-maxZoneOffset-utils.LIVE_PHOTO_WINDOW), f.TakenAt.Add(maxZoneOffset+utils.LIVE_PHOTO_WINDOW))
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range near {
+		if c.ID == f.ID || c.StackID != 0 || isStill(c) == isStill(f) || (!isStill(c) && !isClip(c)) {
+			continue
+		}
+
+		if baseName(c.OriginalName) != baseName(f.OriginalName) || !sameMoment(c.TakenAt, f.TakenAt, utils.LIVE_PHOTO_WINDOW) {
+			continue
+		}
+
+		still, clip := f, c
+		if isClip(f) {
+			still, clip = c, f
+		}
+
+		if _, err := pg.CreateStack(username, models.StackLive, still.ID, []int{still.ID, clip.ID}); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// shots of one camera at most BURST_GAP apart, the first one is the primary
+func stackBurst(pg *db.Postgres, username string, f models.StackCandidate) (bool, error) {
+	if !isStill(f) || (f.StackID != 0 && f.StackKind != models.StackBurst) {
+		return false, nil
+	}
+
+	near, err := pg.GetStackCandidatesBetween(username,
+		f.TakenAt.Add(-utils.STACK_SEARCH_SPAN), f.TakenAt.Add(utils.STACK_SEARCH_SPAN))
+	if err != nil {
+		return false, err
+	}
+
+	var shots []models.StackCandidate
+	at := -1
+	for _, c := range near {
+		if !isStill(c) || c.CameraModel != f.CameraModel || (c.StackID != 0 && c.StackKind != models.StackBurst) {
+			continue
+		}
+
+		if c.ID == f.ID {
+			at = len(shots)
+		}
+		shots = append(shots, c)
+	}
+
+	if at < 0 {
+		return false, nil
+	}
+
+	lo, hi := at, at
+	for lo > 0 && shots[lo].TakenAt.Sub(shots[lo-1].TakenAt) <= utils.BURST_GAP {
+		lo--
+	}
+	for hi < len(shots)-1 && shots[hi+1].TakenAt.Sub(shots[hi].TakenAt) <= utils.BURST_GAP {
+		hi++
+	}
+
+	burst := shots[lo : hi+1]
+	if len(burst) < utils.BURST_MIN_SHOTS {
+		return false, nil
+	}
+
+	// grow a burst stacked before, merging any other one in reach
+	stackId := 0
+	ids := make([]int, len(burst))
+	for i, c := range burst {
+		ids[i] = c.ID
+		if stackId == 0 && c.StackID != 0 {
+			stackId = c.StackID
+		}
+	}
+
+	if stackId == 0 {
+		_, err := pg.CreateStack(username, models.StackBurst, burst[0].ID, ids)
+		return err == nil, err
+	}
+
+	complete := true
+	for _, c := range burst {
+		complete = complete && c.StackID == stackId
+	}
+	if complete {
+		return false, nil
+	}
+
+	err = pg.AddStackFiles(username, strconv.Itoa(stackId), ids)
+	return err == nil, err
+}
+
+// puts a file into a live photo or burst stack when it belongs to one
+func stackFile(pg *db.Postgres, username string, fileId int) (bool, error) {
+	f, ok, err := pg.GetStackCandidate(fileId)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if stacked, err := stackLivePhoto(pg, username, f); err != nil || stacked {
+		return stacked, err
+	}
+
+	return stackBurst(pg, username, f)
+}
+
+// auto stacking for files uploaded before stacks existed, runs over every
+// unstacked file of the user
+type detectStacks struct {
+	pg       *db.Postgres
+	cache    *cache.Cache
+	username string
+}
+
+func DetectStacks(pg *db.Postgres, cache *cache.Cache, username string) *detectStacks {
+	return &detectStacks{
+		pg:       pg,
+		cache:    cache,
+		username: username,
+	}
+}
+
+func (d *detectStacks) process() error {
+	ids, err := d.pg.GetUnstackedFileIds(d.username)
+	if err != nil {
+		return fmt.Errorf("detect stacks: %v", err)
+	}
+
+	stacks := 0
+	for _, id := range ids {
+		stacked, err := stackFile(d.pg, d.username, id)
+		if err != nil {
+			log.Printf("failed to stack file %d: %v", id, err)
+			continue
+		}
+		if stacked {
+			stacks++
+		}
+	}
+
+	if stacks > 0 {
+		d.cache.InvalidateUserGallery(d.username)
+	}
+
+	return nil
+}
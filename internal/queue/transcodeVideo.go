@@ -0,0 +1,221 @@
+package queue
+
+import (
+	"fmt"
+	"kmem/internal/cache"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/media"
+	"kmem/internal/models"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type renditionSize struct {
+	name      string // 360p, 720p, 1080p
+	short     int    // short side, height for landscape videos
+	bandwidth int    // video bitrate in bits per second
+}
+
+// h.264/aac hls renditions so any browser can play any upload
+type transcodeVideo struct {
+	rs    []renditionSize
+	file  models.File
+	pg    *db.Postgres
+	conf  *config.Config
+	cache *cache.Cache
+	bus   *events.Bus
+}
+
+func TranscodeVideo(pg *db.Postgres, conf *config.Config, cache *cache.Cache, bus *events.Bus, file models.File) *transcodeVideo {
+	return &transcodeVideo{
+		rs: []renditionSize{
+			{name: "360p", short: 360, bandwidth: 800_000},
+			{name: "720p", short: 720, bandwidth: 2_800_000},
+			{name: "1080p", short: 1080, bandwidth: 5_000_000},
+		},
+		file:  file,
+		pg:    pg,
+		conf:  conf,
+		cache: cache,
+		bus:   bus,
+	}
+}
+
+// no upscaling, a video smaller than the lowest size still gets that one at its own size
+func (t transcodeVideo) sizes(w, h int) []renditionSize {
+	short := min(w, h)
+
+	var sizes []renditionSize
+	for _, rs := range t.rs {
+		if rs.short <= short || len(sizes) == 0 {
+			sizes = append(sizes, rs)
+		}
+	}
+
+	return sizes
+}
+
+// output dimensions for a short side, kept even for the encoder
+func scaledSize(w, h, short int) (int, int) {
+	even := func(n int) int { return (n + 1) / 2 * 2 }
+
+	if short > min(w, h) {
+		short = min(w, h)
+	}
+
+	if w >= h {
+		return even(w * short / h), even(short)
+	}
+
+	return even(short), even(h * short / w)
+}
+
+func (t transcodeVideo) encode(p *media.Probe, edits []models.EditOp, rs renditionSize, w, h int, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %v", rs.name, err)
+	}
+
+	vf := fmt.Sprintf("scale=%d:%d", w, h)
+	if ef := media.EditFilter(edits); len(ef) > 0 {
+		vf = ef + "," + vf
+	}
+
+	args := []string{
+		"-i", t.file.FilePath,
+		"-vf", vf,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", "main",
+		"-pix_fmt", "yuv420p",
+		"-maxrate", fmt.Sprint(rs.bandwidth),
+		"-bufsize", fmt.Sprint(rs.bandwidth * 2),
+		"-crf", "23",
+		// fixed gop so segments cut on keyframes
+		"-g", "48",
+		"-keyint_min", "48",
+		"-sc_threshold", "0",
+	}
+
+	if p.HasAudio {
+		args = append(args, "-c:a", "aac", "-b:a", "128k", "-ac", "2")
+	} else {
+		args = append(args, "-an")
+	}
+
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", "6",
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%03d.ts"),
+		"-y",
+		filepath.Join(dir, "index.m3u8"),
+	)
+
+	if out, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg %s: %v: %s", rs.name, err, lastLine(out))
+	}
+
+	return nil
+}
+
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return lines[len(lines)-1]
+}
+
+func writeMaster(dir string, renditions []models.Rendition) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for _, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n",
+			r.Bandwidth, r.Width, r.Height, r.Name)
+	}
+
+	return os.WriteFile(filepath.Join(dir, "master.m3u8"), []byte(b.String()), 0644)
+}
+
+func (t transcodeVideo) process() error {
+	p, err := media.ProbeVideo(t.file.FilePath)
+	if err != nil {
+		return fmt.Errorf("transcode %d: %v", t.file.ID, err)
+	}
+
+	edits, err := t.pg.GetFileEdits(t.file.ID)
+	if err != nil {
+		return fmt.Errorf("transcode %d: %v", t.file.ID, err)
+	}
+
+	dispW, dispH := p.DisplaySize()
+	srcW, srcH := media.EditedSize(dispW, dispH, edits.Ops)
+	if srcW == 0 || srcH == 0 {
+		return fmt.Errorf("transcode %d: no video stream", t.file.ID)
+	}
+
+	prev, err := t.pg.GetRenditionDir(t.file.ID)
+	if err != nil {
+		return fmt.Errorf("transcode %d: %v", t.file.ID, err)
+	}
+
+	// segments are cached as immutable, edited videos get a new dir
+	name := t.file.StoredName
+	if edits.Version > 0 {
+		name = fmt.Sprintf("%s.v%d", name, edits.Version)
+	}
+
+	dir := filepath.Join(filepath.Dir(t.file.FilePath), "renditions", name)
+	// built next to the final dir and swapped in at the end, cleanItems leaves .part dirs alone
+	tmp := dir + ".part"
+
+	os.RemoveAll(tmp)
+
+	var renditions []models.Rendition
+	for _, rs := range t.sizes(srcW, srcH) {
+		w, h := scaledSize(srcW, srcH, rs.short)
+
+		if err := t.encode(p, edits.Ops, rs, w, h, filepath.Join(tmp, rs.name)); err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("transcode %d: %v", t.file.ID, err)
+		}
+
+		variantDir := filepath.Join(dir, rs.name)
+		renditions = append(renditions, models.Rendition{
+			FileID:       t.file.ID,
+			Name:         rs.name,
+			Width:        w,
+			Height:       h,
+			Bandwidth:    rs.bandwidth,
+			DirPath:      variantDir,
+			RelativePath: "/static" + strings.TrimPrefix(filepath.Join(variantDir, "index.m3u8"), t.conf.UploadPath()),
+		})
+	}
+
+	if err := writeMaster(tmp, renditions); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("transcode %d: failed to write master playlist: %v", t.file.ID, err)
+	}
+
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("transcode %d: %v", t.file.ID, err)
+	}
+
+	if err := t.pg.ReplaceRenditions(t.file.ID, renditions); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("transcode %d: %v", t.file.ID, err)
+	}
+
+	if len(prev) > 0 && prev != dir {
+		os.RemoveAll(prev)
+	}
+
+	t.cache.InvalidateUserGallery(t.file.Username)
+	t.bus.Publish(t.file.Username, models.EventVideoReady, models.FileEvent{FileID: t.file.ID})
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"fmt"
+	"kmem/internal/archive"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// builds a zip of the selected files on disk for downloads too big to stream
+type zipFiles struct {
+	pg       *db.Postgres
+	conf     *config.Config
+	bus      *events.Bus
+	jobId    int
+	username string
+	files    []models.File
+}
+
+func ZipFiles(pg *db.Postgres, conf *config.Config, bus *events.Bus, jobId int, username string, files []models.File) *zipFiles {
+	return &zipFiles{
+		pg:       pg,
+		conf:     conf,
+		bus:      bus,
+		jobId:    jobId,
+		username: username,
+		files:    files,
+	}
+}
+
+func (z *zipFiles) build(dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer out.Close()
+
+	zw := archive.NewZip(out)
+	namer := archive.NewNamer()
+
+	for i, file := range z.files {
+		if err := zw.AddFile(namer.Unique(file.OriginalName), file.FilePath, file.CapturedAt()); err != nil {
+			return err
+		}
+
+		if err := z.pg.UpdateJobProgress(z.jobId, i+1, len(z.files)); err != nil {
+			log.Printf("failed to update job %d progress: %v", z.jobId, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+
+	return out.Close()
+}
+
+func (z *zipFiles) process() error {
+	dir := filepath.Join(z.conf.ExportPath(), z.username)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		failJob(z.pg, z.bus, z.username, z.jobId, models.JobKindZip, err)
+		return fmt.Errorf("failed to create export directory: %v", err)
+	}
+
+	dst := filepath.Join(dir, fmt.Sprintf("%d.zip", z.jobId))
+	tmp := dst + ".part"
+
+	if err := z.build(tmp); err != nil {
+		os.Remove(tmp)
+		failJob(z.pg, z.bus, z.username, z.jobId, models.JobKindZip, err)
+		return fmt.Errorf("zip job %d: %v", z.jobId, err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		failJob(z.pg, z.bus, z.username, z.jobId, models.JobKindZip, err)
+		return fmt.Errorf("zip job %d: %v", z.jobId, err)
+	}
+
+	if err := z.pg.FinishJob(z.jobId, dst, time.Now().Add(utils.JOB_RESULT_DUR)); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("zip job %d: %v", z.jobId, err)
+	}
+
+	doneJob(z.bus, z.username, z.jobId, models.JobKindZip)
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package router
+
+import (
+	"fmt"
+	"kmem/internal/cache"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/geo"
+	"kmem/internal/models"
+	"kmem/internal/queue"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// must run after authMiddleware
+func adminMiddleware(conf *config.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, _ := ctx.Get(utils.USERNAME_KEY)
+		username, _ := v.(string)
+
+		if !conf.IsAdmin(username) {
+			models.ErrorResponse(
+				http.StatusForbidden,
+				models.ErrForbidden,
+				"admin only",
+			).Send(ctx)
+
+			ctx.Abort()
+
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// keeps requested paths inside the configured import directory
+func resolveImportPath(root, rel string) (string, error) {
+	if len(root) == 0 {
+		return "", fmt.Errorf("import path not configured")
+	}
+
+	p := filepath.Join(root, rel)
+
+	r, err := filepath.Rel(root, p)
+	if err != nil || r == ".." || strings.HasPrefix(r, "../") {
+		return "", fmt.Errorf("path outside of import directory")
+	}
+
+	return p, nil
+}
+
+// imports a directory or archive under the import path into a user's account
+func importFiles(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus, geocoder *geo.Geocoder) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		admin, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			Username string `json:"username" binding:"required"`
+			Path     string `json:"path" binding:"required"` // relative to importPath
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"username and path required",
+			).Send(ctx)
+
+			return
+		}
+
+		src, err := resolveImportPath(conf.ImportPath(), req.Path)
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				err.Error(),
+			).Send(ctx)
+
+			return
+		}
+
+		if _, err := pg.QueryUser(req.Username); err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrRecordNotFound,
+				"user not found",
+			).Send(ctx)
+
+			return
+		}
+
+		// the admin follows the job, the files go to the target user
+		job := models.Job{Username: admin, Kind: models.JobKindImport}
+
+		jobId, err := pg.InsertJob(job)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to create import job",
+			).Send(ctx)
+
+			return
+		}
+
+		job.ID = jobId
+		job.Status = models.JobPending
+
+		models.SuccessResponse(models.JobResponse{Job: job}).Send(ctx)
+
+		q.Add(queue.ImportFiles(pg, conf, cache, bus, geocoder, q, jobId, admin, req.Username, src))
+	}
+}
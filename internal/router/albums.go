@@ -0,0 +1,486 @@
+package router
+
+import (
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getAlbums(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		albums, err := pg.GetAlbums(username)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get albums",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(albums).Send(ctx)
+	}
+}
+
+func createAlbum(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			Name  string             `json:"name" binding:"required"`
+			Query *models.FileFilter `json:"query"` // makes it a smart album
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil || len(req.Name) > 255 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"album name required",
+			).Send(ctx)
+
+			return
+		}
+
+		if req.Query != nil {
+			if err := req.Query.Validate(); err != nil {
+				models.ErrorResponse(
+					http.StatusBadRequest,
+					models.ErrValidation,
+					err.Error(),
+				).Send(ctx)
+
+				return
+			}
+		}
+
+		albumId, err := pg.InsertAlbum(models.Album{Username: username, Name: req.Name, Query: req.Query})
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to create album",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(map[string]any{"id": albumId}).Send(ctx)
+	}
+}
+
+func renameAlbum(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil || len(req.Name) > 255 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"album name required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.RenameAlbum(username, ctx.Param("albumId"), req.Name); err != nil {
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to rename album",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+// changes the saved filter of a smart album
+func updateAlbumQuery(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var filter models.FileFilter
+		if err := ctx.ShouldBindJSON(&filter); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"invalid query",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := filter.Validate(); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				err.Error(),
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.SetAlbumQuery(username, ctx.Param("albumId"), filter); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to update album query",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+func deleteAlbum(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		// members lose the album's files, look them up before they're gone
+		audience, err := pg.GetAlbumAudience(ctx.Param("albumId"))
+		if err != nil {
+			log.Println(err)
+		}
+
+		if err := pg.DeleteAlbum(username, ctx.Param("albumId")); err != nil {
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to delete album",
+			).Send(ctx)
+
+			return
+		}
+
+		for _, name := range audience {
+			cache.InvalidateUserGallery(name)
+		}
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+func getAlbumFiles(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		album, err := pg.GetAlbum(username, ctx.Param("albumId"))
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrRecordNotFound,
+				"album not found",
+			).Send(ctx)
+
+			return
+		}
+
+		limit, page := getLimitPageQuery(ctx.Query("limit"), ctx.Query("page"))
+
+		type Page struct {
+			Files    []models.FileResponse `json:"files"`
+			HasNext  bool                  `json:"hasNext"`
+			NextPage int                   `json:"nextPage"`
+		}
+
+		// smart albums page & sort like the gallery
+		if album.IsSmart() {
+			sort := ctx.Query("sort")
+			if len(sort) == 0 {
+				sort = "date"
+			}
+
+			// evaluated over the owner's own files, not what others share with them
+			files, err := pg.GetFilesPage(album.Username, page, limit, sort, *album.Query, true)
+			if err != nil {
+				log.Println(err)
+
+				models.ErrorResponse(
+					http.StatusInternalServerError,
+					models.ErrDatabase,
+					"failed to get album files",
+				).Send(ctx)
+
+				return
+			}
+
+			total, err := pg.GetFilesCount(album.Username, *album.Query, true)
+			if err != nil {
+				log.Println(err)
+
+				models.ErrorResponse(
+					http.StatusInternalServerError,
+					models.ErrDatabase,
+					"failed to get album files",
+				).Send(ctx)
+
+				return
+			}
+
+			models.SuccessResponse(Page{
+				Files:    files,
+				HasNext:  (page+1)*limit < total,
+				NextPage: page + 1,
+			}).Send(ctx)
+
+			return
+		}
+
+		files, err := pg.GetAlbumFilesPage(username, ctx.Param("albumId"), page, limit)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get album files",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(Page{
+			Files:    files,
+			HasNext:  len(files) == limit,
+			NextPage: page + 1,
+		}).Send(ctx)
+	}
+}
+
+func addAlbumFiles(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			FileIDs []int `json:"fileIds" binding:"required"`
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"file ids required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.AddAlbumFiles(username, ctx.Param("albumId"), req.FileIDs); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to add files to album",
+			).Send(ctx)
+
+			return
+		}
+
+		invalidateAlbumAudience(pg, cache, ctx.Param("albumId"))
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+func removeAlbumFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.RemoveAlbumFile(username, ctx.Param("albumId"), ctx.Param("fileId")); err != nil {
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to remove file from album",
+			).Send(ctx)
+
+			return
+		}
+
+		invalidateAlbumAudience(pg, cache, ctx.Param("albumId"))
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
@@ -0,0 +1,203 @@
+package router
+
+import (
+	"fmt"
+	"kmem/internal/archive"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"kmem/internal/queue"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseDateQuery(s string) (*time.Time, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid date: %s", s)
+}
+
+// GET  /files/download?ids=1,2,3&albumId=&from=2024-01-01&to=2024-02-01&all=1
+// POST /files/download with models.DownloadRequest as json for long selections
+func parseDownloadRequest(ctx *gin.Context) (models.DownloadRequest, error) {
+	var req models.DownloadRequest
+
+	if ctx.Request.Method == http.MethodPost {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return req, fmt.Errorf("invalid request format")
+		}
+
+		return req, nil
+	}
+
+	if ids := ctx.Query("ids"); len(ids) > 0 {
+		for _, idStr := range strings.Split(ids, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(idStr))
+			if err != nil {
+				return req, fmt.Errorf("invalid file id: %s", idStr)
+			}
+
+			req.FileIDs = append(req.FileIDs, id)
+		}
+	}
+
+	if albumId := ctx.Query("albumId"); len(albumId) > 0 {
+		id, err := strconv.Atoi(albumId)
+		if err != nil {
+			return req, fmt.Errorf("invalid album id: %s", albumId)
+		}
+
+		req.AlbumID = id
+	}
+
+	from, err := parseDateQuery(ctx.Query("from"))
+	if err != nil {
+		return req, err
+	}
+
+	to, err := parseDateQuery(ctx.Query("to"))
+	if err != nil {
+		return req, err
+	}
+
+	req.From, req.To = from, to
+	req.All = ctx.Query("all") == "1" || ctx.Query("all") == "true"
+
+	return req, nil
+}
+
+func downloadFiles(pg *db.Postgres, conf *config.Config, q *queue.Queue, bus *events.Bus) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		req, err := parseDownloadRequest(ctx)
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				err.Error(),
+			).Send(ctx)
+
+			return
+		}
+
+		if req.IsEmpty() {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"nothing selected to download",
+			).Send(ctx)
+
+			return
+		}
+
+		files, err := pg.GetFilesForDownload(username, req)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get files",
+			).Send(ctx)
+
+			return
+		}
+
+		if len(files) == 0 {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrFileNotFound,
+				"no files matched the selection",
+			).Send(ctx)
+
+			return
+		}
+
+		var totalSize int64
+		for _, f := range files {
+			totalSize += f.FileSize
+		}
+
+		// too big to stream in one request - build it in the background
+		if totalSize > conf.ZipStreamLimit() {
+			job := models.Job{Username: username, Kind: models.JobKindZip, Total: len(files)}
+
+			jobId, err := pg.InsertJob(job)
+			if err != nil {
+				log.Println(err)
+
+				models.ErrorResponse(
+					http.StatusInternalServerError,
+					models.ErrDatabase,
+					"failed to create download job",
+				).Send(ctx)
+
+				return
+			}
+
+			job.ID = jobId
+			job.Status = models.JobPending
+
+			models.SuccessResponse(models.JobResponse{Job: job}).Send(ctx)
+
+			q.Add(queue.ZipFiles(pg, conf, bus, jobId, username, files))
+			return
+		}
+
+		filename := fmt.Sprintf("kmem-%s.zip", time.Now().Format("20060102-150405"))
+		ctx.Header("Content-Type", "application/zip")
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		ctx.Status(http.StatusOK)
+
+		zw := archive.NewZip(ctx.Writer)
+		namer := archive.NewNamer()
+
+		for _, file := range files {
+			if err := zw.AddFile(namer.Unique(file.OriginalName), file.FilePath, file.CapturedAt()); err != nil {
+				// headers are gone already, the client sees a truncated archive
+				log.Printf("zip download for %s aborted: %v", username, err)
+				return
+			}
+		}
+
+		if err := zw.Close(); err != nil {
+			log.Printf("failed to finish zip download for %s: %v", username, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package router
+
+import (
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/dedupe"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"kmem/internal/queue"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groups of near duplicate images with a suggested copy to keep, ?distance=
+// loosens or tightens the match. only pairs found by a scan show up
+func getDuplicates(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		distance := utils.DUPLICATE_DISTANCE
+		if d := ctx.Query("distance"); len(d) > 0 {
+			n, err := strconv.Atoi(d)
+			if err != nil || n < 0 || n > utils.MAX_DUPLICATE_DISTANCE {
+				models.ErrorResponse(
+					http.StatusBadRequest,
+					models.ErrValidation,
+					"invalid distance",
+				).Send(ctx)
+
+				return
+			}
+			distance = n
+		}
+
+		files, err := pg.GetHashedFiles(username)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get duplicates",
+			).Send(ctx)
+
+			return
+		}
+
+		pairs, err := pg.GetDuplicatePairs(username, distance)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get duplicates",
+			).Send(ctx)
+
+			return
+		}
+
+		groups := dedupe.Group(files, pairs, distance)
+		if groups == nil {
+			groups = []models.DuplicateGroup{}
+		}
+
+		models.SuccessResponse(models.DuplicatesResponse{Groups: groups, Distance: distance}).Send(ctx)
+	}
+}
+
+// hashes new and edited images in the background, see getJob for progress
+func scanDuplicates(pg *db.Postgres, q *queue.Queue, bus *events.Bus) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		job := models.Job{Username: username, Kind: models.JobKindHash}
+
+		jobId, err := pg.InsertJob(job)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to create hash job",
+			).Send(ctx)
+
+			return
+		}
+
+		job.ID = jobId
+		job.Status = models.JobPending
+
+		models.SuccessResponse(models.JobResponse{Job: job}).Send(ctx)
+
+		q.Add(queue.HashFiles(pg, bus, jobId, username))
+	}
+}
+
+// moves the copies not kept to the trash in one go
+func trashDuplicates(pg *db.Postgres, cache *cache.Cache, bus *events.Bus) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.TrashRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || len(req.FileIDs) == 0 || len(req.FileIDs) > utils.MAX_TRASH_BATCH {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"invalid file ids",
+			).Send(ctx)
+
+			return
+		}
+
+		trashed, err := pg.TrashFiles(username, req.FileIDs)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to trash files",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(models.TrashResponse{Trashed: trashed}).Send(ctx)
+
+		for _, id := range trashed {
+			bus.Publish(username, models.EventFileDeleted, models.FileEvent{FileID: id})
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package router
+
+import (
+	"fmt"
+	"kmem/internal/cache"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/media"
+	"kmem/internal/models"
+	"kmem/internal/queue"
+	"kmem/internal/utils"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// derivatives are rebuilt from the original with the whole edit stack applied
+func regenerate(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus, file models.File) {
+	q.Add(queue.GenThumbnail(pg, conf, bus, file))
+	if file.IsVideo() {
+		q.Add(queue.TranscodeVideo(pg, conf, cache, bus, file))
+	}
+}
+
+// empty when ops can be applied to file
+func checkEdits(file models.File, ops []models.EditOp) string {
+	if !file.IsImage() && !file.IsVideo() {
+		return "only images and videos can be edited"
+	}
+
+	if len(ops) > utils.MAX_EDIT_OPS {
+		return fmt.Sprintf("at most %d edits", utils.MAX_EDIT_OPS)
+	}
+
+	for _, op := range ops {
+		if !op.Valid() {
+			return "invalid edit"
+		}
+		if file.IsVideo() && !op.ForVideo() {
+			return "videos can only be rotated and flipped"
+		}
+	}
+
+	return ""
+}
+
+func getFileEdits(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		file, err := pg.QueryFile(username, ctx.Param("fileId"))
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrFileNotFound,
+				"file not found",
+			).Send(ctx)
+
+			return
+		}
+
+		edits, err := pg.GetFileEdits(file.ID)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get edits",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(edits).Send(ctx)
+	}
+}
+
+// pushes one edit onto the stack of a file
+//
+//	{"op": "rotate", "angle": 90}
+//	{"op": "flip", "axis": "horizontal"}
+//	{"op": "crop", "x": 0.1, "y": 0, "width": 0.8, "height": 0.5}
+//	{"op": "adjust", "brightness": 10, "contrast": -5, "saturation": 20}
+//	{"op": "filter", "name": "sepia"}
+func addFileEdit(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var op models.EditOp
+		if err := ctx.ShouldBindJSON(&op); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"invalid edit",
+			).Send(ctx)
+
+			return
+		}
+
+		fileId := ctx.Param("fileId")
+
+		file, err := pg.QueryFile(username, fileId)
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrFileNotFound,
+				"file not found",
+			).Send(ctx)
+
+			return
+		}
+
+		current, err := pg.GetFileEdits(file.ID)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get edits",
+			).Send(ctx)
+
+			return
+		}
+
+		if msg := checkEdits(file, append(current.Ops, op)); len(msg) > 0 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				msg,
+			).Send(ctx)
+
+			return
+		}
+
+		edits, err := pg.AppendFileEdit(username, fileId, op)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to save edit",
+			).Send(ctx)
+
+			return
+		}
+
+		regenerate(pg, conf, q, cache, bus, file)
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(edits).Send(ctx)
+	}
+}
+
+// replaces the whole stack, for undo/redo on the client. no ops or DELETE
+// reverts to the original
+func replaceFileEdits(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.EditsRequest
+		if ctx.Request.Method != http.MethodDelete {
+			if err := ctx.ShouldBindJSON(&req); err != nil {
+				models.ErrorResponse(
+					http.StatusBadRequest,
+					models.ErrInvalidInput,
+					"invalid edits",
+				).Send(ctx)
+
+				return
+			}
+		}
+
+		fileId := ctx.Param("fileId")
+
+		file, err := pg.QueryFile(username, fileId)
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrFileNotFound,
+				"file not found",
+			).Send(ctx)
+
+			return
+		}
+
+		if msg := checkEdits(file, req.Ops); len(msg) > 0 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				msg,
+			).Send(ctx)
+
+			return
+		}
+
+		edits, err := pg.ReplaceFileEdits(username, fileId, req.Ops)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to save edits",
+			).Send(ctx)
+
+			return
+		}
+
+		regenerate(pg, conf, q, cache, bus, file)
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(edits).Send(ctx)
+	}
+}
+
+// the full size image with every edit applied, as a download. jpeg and png
+// keep their format, everything else becomes jpeg
+func exportEdited(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		file, err := pg.QueryFile(username, ctx.Param("fileId"))
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrFileNotFound,
+				"file not found",
+			).Send(ctx)
+
+			return
+		}
+
+		if !file.IsImage() {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidFile,
+				"only images can be exported edited",
+			).Send(ctx)
+
+			return
+		}
+
+		edits, err := pg.GetFileEdits(file.ID)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get edits",
+			).Send(ctx)
+
+			return
+		}
+
+		src, err := media.DecodeImage(file.FilePath, file.MimeType)
+		if err != nil {
+			log.Printf("failed to open %s: %v\n", file.FilePath, err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrInvalidFile,
+				"failed to render image",
+			).Send(ctx)
+
+			return
+		}
+
+		format, contentType := "jpeg", "image/jpeg"
+		if file.MimeType == "image/png" {
+			format, contentType = "png", "image/png"
+		}
+
+		name := strings.TrimSuffix(file.OriginalName, filepath.Ext(file.OriginalName)) + "-edited" + media.Extensions[format]
+
+		ctx.Header("Content-Type", contentType)
+		ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+
+		// nothing is sent before encoding starts, a failure midway can only be logged
+		if err := media.Encode(ctx.Writer, media.ApplyEdits(src, edits.Ops), format); err != nil {
+			log.Printf("failed to export edited %d: %v\n", file.ID, err)
+		}
+	}
+}
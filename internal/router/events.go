@@ -0,0 +1,88 @@
+package router
+
+import (
+	"io"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// server-sent events, one stream per open tab/device
+func streamEvents(bus *events.Bus) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		evs, unsubscribe := bus.Subscribe(username)
+		defer unsubscribe()
+
+		ctx.Header("Content-Type", "text/event-stream")
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("Connection", "keep-alive")
+		ctx.Header("X-Accel-Buffering", "no") // nginx
+
+		ticker := time.NewTicker(utils.SSE_KEEPALIVE_DUR)
+		defer ticker.Stop()
+
+		// send headers now, EventSource waits for them before firing onopen
+		ctx.Status(http.StatusOK)
+		ctx.Writer.Flush()
+
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case ev := <-evs:
+				ctx.SSEvent(string(ev.Kind), ev.Data)
+				return true
+			case <-ticker.C:
+				_, err := io.WriteString(w, ": ping\n\n")
+				return err == nil
+			}
+		})
+	}
+}
+
+// tells the user once their usage passes the warning ratio of the quota
+func warnQuota(pg *db.Postgres, conf *config.Config, bus *events.Bus, username string) {
+	quota := conf.Quota()
+	if quota <= 0 {
+		return
+	}
+
+	_, used, err := pg.GetUserFilesUsage(username)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if float64(used) >= float64(quota)*utils.QUOTA_WARN_RATIO {
+		bus.Publish(username, models.EventQuotaWarning, models.QuotaEvent{Used: used, Quota: quota})
+	}
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"kmem/internal/queue"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// starts a takeout job, progress & download link through /jobs/:jobId
+func exportAccount(pg *db.Postgres, conf *config.Config, q *queue.Queue, bus *events.Bus) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			Format string `json:"format"` // zip (default), tar
+		}
+
+		// empty body is fine
+		ctx.ShouldBindJSON(&req)
+
+		if len(req.Format) == 0 {
+			req.Format = "zip"
+		}
+
+		if req.Format != "zip" && req.Format != "tar" {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"format must be zip or tar",
+			).Send(ctx)
+
+			return
+		}
+
+		job := models.Job{Username: username, Kind: models.JobKindExport}
+
+		jobId, err := pg.InsertJob(job)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to create export job",
+			).Send(ctx)
+
+			return
+		}
+
+		job.ID = jobId
+		job.Status = models.JobPending
+
+		models.SuccessResponse(models.JobResponse{Job: job}).Send(ctx)
+
+		q.Add(queue.ExportAccount(pg, conf, bus, jobId, username, req.Format))
+	}
+}
@@ -1,16 +1,16 @@
 package router
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"io"
 	"kmem/internal/cache"
 	"kmem/internal/config"
 	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/geo"
 	"kmem/internal/models"
 	"kmem/internal/queue"
 	"kmem/internal/utils"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -83,7 +83,7 @@ func servFiles(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
 			return
 		}
 
-		dbfiles, err := pg.GetFilesPage(username, page, limit, sort, typeStr, searchStr)
+		dbfiles, err := pg.GetFilesPage(username, page, limit, sort, models.FileFilter{Type: typeStr, Search: searchStr}, false)
 		if err != nil {
 
 			fmt.Println(err)
@@ -97,7 +97,7 @@ func servFiles(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
 			return
 		}
 
-		totalFiles, err := pg.GetFilesCount(username, typeStr, searchStr)
+		totalFiles, err := pg.GetFilesCount(username, models.FileFilter{Type: typeStr, Search: searchStr}, false)
 		if err != nil {
 			models.ErrorResponse(
 				http.StatusInternalServerError,
@@ -125,7 +125,7 @@ func servFiles(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
 	}
 }
 
-func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache) gin.HandlerFunc {
+func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus, geocoder *geo.Geocoder) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		v, ok := ctx.Get(utils.USERNAME_KEY)
 		if !ok {
@@ -160,8 +160,55 @@ func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.C
 			return
 		}
 
+		// general files are usually sorted into a folder on upload
+		var folderId *int
+		if param := ctx.Query("folderId"); len(param) > 0 {
+			id, err := strconv.Atoi(param)
+			if err != nil {
+				models.ErrorResponse(
+					http.StatusBadRequest,
+					models.ErrValidation,
+					"invalid folder id",
+				).Send(ctx)
+
+				return
+			}
+
+			crumbs, err := pg.GetBreadcrumb(username, id)
+			if err != nil || len(crumbs) == 0 {
+				models.ErrorResponse(
+					http.StatusNotFound,
+					models.ErrRecordNotFound,
+					"folder not found",
+				).Send(ctx)
+
+				return
+			}
+
+			folderId = &id
+		}
+
+		// contributors upload straight into a shared album
+		albumId := ctx.Query("albumId")
+		if len(albumId) > 0 {
+			role, err := pg.AlbumRole(username, albumId)
+			if err != nil {
+				log.Println(err)
+			}
+
+			if !models.RoleAtLeast(role, models.RoleContributor) {
+				models.ErrorResponse(
+					http.StatusForbidden,
+					models.ErrForbidden,
+					"not allowed to upload into this album",
+				).Send(ctx)
+
+				return
+			}
+		}
+
 		// process filename
-		originalName, safename, mimeType, err := utils.ProcessFilename(encodedName)
+		originalName, safename, mimeType, err := utils.ProcessFilename(encodedName, conf.BlockedExtensions())
 		if err != nil {
 			models.ErrorResponse(
 				http.StatusBadRequest,
@@ -172,6 +219,29 @@ func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.C
 			return
 		}
 
+		// the extension only tells what the file claims to be
+		head, body, err := utils.PeekHead(ctx.Request.Body)
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"failed to read upload",
+			).Send(ctx)
+
+			return
+		}
+
+		mimeType, err = utils.DetectMimeType(head, mimeType)
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusUnsupportedMediaType,
+				models.ErrInvalidFile,
+				err.Error(),
+			).Send(ctx)
+
+			return
+		}
+
 		dst := fmt.Sprintf("%s/%s/%s", conf.UploadPath(), username, safename)
 
 		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
@@ -184,9 +254,6 @@ func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.C
 			return
 		}
 
-		//
-		hasher := sha256.New()
-
 		file, err := os.Create(dst)
 		if err != nil {
 			models.ErrorResponse(
@@ -201,7 +268,7 @@ func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.C
 		}
 		defer file.Close()
 
-		size, err := io.Copy(io.MultiWriter(file, hasher), ctx.Request.Body)
+		size, hash, err := utils.CopyAndHash(file, body)
 		if err != nil {
 			models.ErrorResponse(
 				http.StatusInternalServerError,
@@ -214,7 +281,18 @@ func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.C
 			return
 		}
 
-		hash := hex.EncodeToString(hasher.Sum(nil))
+		// another account has the same content, hashes are unique so it can't be stored twice
+		if existing, err := pg.QueryFileByHash(hash); err == nil && existing.Username != username {
+			os.Remove(dst)
+
+			models.ErrorResponse(
+				http.StatusConflict,
+				models.ErrValidation,
+				"file already exists",
+			).Send(ctx)
+
+			return
+		}
 
 		// into db
 		filemeta := models.File{
@@ -226,6 +304,7 @@ func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.C
 			RelativePath: "/static" + strings.TrimPrefix(dst, conf.UploadPath()),
 			FileSize:     size,
 			MimeType:     mimeType,
+			FolderID:     folderId,
 		}
 
 		fileId, err := pg.InsertFile(filemeta)
@@ -245,14 +324,34 @@ func upload(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.C
 
 		cache.InvalidateUserGallery(username)
 
+		if len(albumId) > 0 {
+			if err := pg.AddAlbumFiles(username, albumId, []int{fileId}); err != nil {
+				log.Println(err)
+			}
+			invalidateAlbumAudience(pg, cache, albumId)
+		}
+
 		models.SuccessResponse(nil).Send(ctx)
 
 		filemeta.ID = fileId
-		q.Add(queue.GenThumbnail(pg, conf, filemeta))
+		bus.Publish(username, models.EventUploadDone, models.FileEvent{FileID: fileId, Name: originalName})
+		warnQuota(pg, conf, bus, username)
+
+		q.Add(queue.GenThumbnail(pg, conf, bus, filemeta))
+
+		// general files only get a preview
+		if !filemeta.IsImage() && !filemeta.IsVideo() && !filemeta.IsAudio() {
+			return
+		}
+
+		q.Add(queue.ExtractMetadata(pg, cache, geocoder, filemeta))
+		if filemeta.IsVideo() {
+			q.Add(queue.TranscodeVideo(pg, conf, cache, bus, filemeta))
+		}
 	}
 }
 
-func deleteFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+func deleteFile(pg *db.Postgres, cache *cache.Cache, bus *events.Bus) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		v, ok := ctx.Get(utils.USERNAME_KEY)
 		if !ok {
@@ -287,7 +386,8 @@ func deleteFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
 			return
 		}
 
-		if err := pg.DeleteFileSoft(username, fileId); err != nil {
+		deleted, err := pg.DeleteFileSoft(username, fileId)
+		if err != nil {
 			models.ErrorResponse(
 				http.StatusInternalServerError,
 				models.ErrDatabase,
@@ -299,10 +399,19 @@ func deleteFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
 
 		cache.InvalidateUserGallery(username)
 		models.SuccessResponse(nil).Send(ctx)
+
+		// already trashed or not the user's, nothing happened to announce
+		if !deleted {
+			return
+		}
+
+		if id, err := strconv.Atoi(fileId); err == nil {
+			notifyFileAudience(pg, cache, bus, id, models.EventFileDeleted, models.FileEvent{FileID: id})
+		}
 	}
 }
 
-func renameFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+func renameFile(pg *db.Postgres, cache *cache.Cache, bus *events.Bus) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		v, ok := ctx.Get(utils.USERNAME_KEY)
 		if !ok {
@@ -350,7 +459,7 @@ func renameFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
 			return
 		}
 
-		err := pg.RenameFile(username, fileId, req.NewName)
+		renamed, err := pg.RenameFile(username, fileId, req.NewName)
 		if err != nil {
 			models.ErrorResponse(
 				http.StatusInternalServerError,
@@ -361,7 +470,173 @@ func renameFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
 			return
 		}
 
+		if !renamed {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrRecordNotFound,
+				"file not found",
+			).Send(ctx)
+
+			return
+		}
+
 		cache.InvalidateUserGallery(username)
 		models.SuccessResponse(nil).Send(ctx)
+
+		if id, err := strconv.Atoi(fileId); err == nil {
+			notifyFileAudience(pg, cache, bus, id, models.EventFileRenamed, models.FileEvent{FileID: id, Name: req.NewName})
+		}
+	}
+}
+
+func updateCaption(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		fileId := ctx.Param("fileId")
+		if len(fileId) == 0 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"file id required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			Caption string `json:"caption"`
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil || len(req.Caption) > 2000 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"invalid caption",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.UpdateCaption(username, fileId, strings.TrimSpace(req.Caption)); err != nil {
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to update caption",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+// lets backup clients skip uploads the server already has
+func checkFiles(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.HashCheckRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"invalid request format",
+			).Send(ctx)
+
+			return
+		}
+
+		if len(req.Files) > utils.MAX_HASH_CHECK {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				fmt.Sprintf("too many files, max %d per request", utils.MAX_HASH_CHECK),
+			).Send(ctx)
+
+			return
+		}
+
+		hashes := make([]string, len(req.Files))
+		for i, f := range req.Files {
+			hashes[i] = strings.ToLower(f.Hash)
+		}
+
+		fmap, err := pg.GetFilesByHashes(username, hashes)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to check files",
+			).Send(ctx)
+
+			return
+		}
+
+		resp := models.HashCheckResponse{
+			Existing: []string{},
+			Trashed:  []string{},
+			Unknown:  []string{},
+		}
+
+		// files of other users are reported as unknown, never leak them
+		for i, f := range req.Files {
+			file, ok := fmap[hashes[i]]
+
+			switch {
+			case !ok || (f.Size > 0 && f.Size != file.FileSize):
+				resp.Unknown = append(resp.Unknown, f.Hash)
+			case file.Deleted:
+				resp.Trashed = append(resp.Trashed, f.Hash)
+			default:
+				resp.Existing = append(resp.Existing, f.Hash)
+			}
+		}
+
+		models.SuccessResponse(resp).Send(ctx)
 	}
 }
@@ -0,0 +1,434 @@
+package router
+
+import (
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lists a folder, the root without :folderId
+func getFolder(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		resp := models.FolderResponse{Breadcrumb: []models.Crumb{}}
+
+		var folderId *int
+		if param := ctx.Param("folderId"); len(param) > 0 {
+			id, err := strconv.Atoi(param)
+			if err != nil {
+				models.ErrorResponse(
+					http.StatusBadRequest,
+					models.ErrValidation,
+					"invalid folder id",
+				).Send(ctx)
+
+				return
+			}
+
+			crumbs, err := pg.GetBreadcrumb(username, id)
+			if err != nil {
+				log.Println(err)
+
+				models.ErrorResponse(
+					http.StatusInternalServerError,
+					models.ErrDatabase,
+					"failed to get folder",
+				).Send(ctx)
+
+				return
+			}
+
+			if len(crumbs) == 0 {
+				models.ErrorResponse(
+					http.StatusNotFound,
+					models.ErrRecordNotFound,
+					"folder not found",
+				).Send(ctx)
+
+				return
+			}
+
+			folderId = &id
+			resp.Breadcrumb = crumbs
+		}
+
+		folders, err := pg.GetFolders(username, folderId)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get folder",
+			).Send(ctx)
+
+			return
+		}
+
+		limit, page := getLimitPageQuery(ctx.Query("limit"), ctx.Query("page"))
+
+		files, err := pg.GetFolderFiles(username, folderId, page, limit)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get folder",
+			).Send(ctx)
+
+			return
+		}
+
+		resp.Folders = folders
+		resp.Files = files
+		resp.HasNext = len(files) == limit
+		resp.NextPage = page + 1
+
+		models.SuccessResponse(resp).Send(ctx)
+	}
+}
+
+func createFolder(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.FolderRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"folder name required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := utils.ValidateFilename(req.Name); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				err.Error(),
+			).Send(ctx)
+
+			return
+		}
+
+		if req.ParentID != nil {
+			crumbs, err := pg.GetBreadcrumb(username, *req.ParentID)
+			if err != nil || len(crumbs) == 0 {
+				models.ErrorResponse(
+					http.StatusNotFound,
+					models.ErrRecordNotFound,
+					"parent folder not found",
+				).Send(ctx)
+
+				return
+			}
+		}
+
+		taken, err := pg.FolderNameTaken(username, req.ParentID, req.Name)
+		if err != nil {
+			log.Println(err)
+		}
+
+		if taken {
+			models.ErrorResponse(
+				http.StatusConflict,
+				models.ErrValidation,
+				"a folder with this name already exists",
+			).Send(ctx)
+
+			return
+		}
+
+		folder, err := pg.CreateFolder(username, req.Name, req.ParentID)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to create folder",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(folder).Send(ctx)
+	}
+}
+
+func renameFolder(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"folder name required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := utils.ValidateFilename(req.Name); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				err.Error(),
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.RenameFolder(username, ctx.Param("folderId"), req.Name); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to rename folder",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+func moveFolder(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.MoveFolderRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"invalid request",
+			).Send(ctx)
+
+			return
+		}
+
+		moved, err := pg.MoveFolder(username, ctx.Param("folderId"), req.ParentID)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to move folder",
+			).Send(ctx)
+
+			return
+		}
+
+		if !moved {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				"folder can't be moved there",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+func deleteFolder(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		deleted, err := pg.DeleteFolder(username, ctx.Param("folderId"))
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to delete folder",
+			).Send(ctx)
+
+			return
+		}
+
+		if !deleted {
+			models.ErrorResponse(
+				http.StatusConflict,
+				models.ErrValidation,
+				"folder not found or not empty",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+func moveFiles(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.MoveFilesRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"file ids required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.MoveFiles(username, req.FileIDs, req.FolderID); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to move files",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
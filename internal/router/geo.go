@@ -0,0 +1,97 @@
+package router
+
+import (
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// "minLon,minLat,maxLon,maxLat" as sent by map libraries, minLon > maxLon
+// for a box over the antimeridian
+func parseBBox(s string) (models.BBox, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return models.BBox{}, false
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return models.BBox{}, false
+		}
+		v[i] = f
+	}
+
+	bbox := models.BBox{MinLon: v[0], MinLat: v[1], MaxLon: v[2], MaxLat: v[3]}
+	if bbox.MinLat < -90 || bbox.MaxLat > 90 || bbox.MinLat >= bbox.MaxLat ||
+		bbox.MinLon < -180 || bbox.MaxLon > 180 || bbox.MinLon == bbox.MaxLon {
+		return models.BBox{}, false
+	}
+
+	return bbox, true
+}
+
+// map markers, ?bbox= is the visible area and takes the same type & search
+// filters as the gallery. the whole world when no bbox is given
+func getGeoClusters(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		bbox := models.BBox{MinLon: -180, MinLat: -90, MaxLon: 180, MaxLat: 90}
+		if b := ctx.Query("bbox"); len(b) > 0 {
+			if bbox, ok = parseBBox(b); !ok {
+				models.ErrorResponse(
+					http.StatusBadRequest,
+					models.ErrValidation,
+					"invalid bbox",
+				).Send(ctx)
+
+				return
+			}
+		}
+
+		filter := models.FileFilter{Type: ctx.Query("type"), Search: ctx.Query("search")}
+
+		clusters, err := pg.GetGeoClusters(username, filter, bbox, utils.GEO_GRID_CELLS)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get map clusters",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(models.GeoResponse{Clusters: clusters}).Send(ctx)
+	}
+}
@@ -0,0 +1,166 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/diskcache"
+	"kmem/internal/media"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+)
+
+// renders an image of the user at an allowed size, ?w=&h=&fit=contain|cover&fmt=jpeg|png|webp|avif
+// without fmt the best format the Accept header allows is picked
+func renderImage(pg *db.Postgres, conf *config.Config, imgCache *diskcache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		width, werr := strconv.Atoi(ctx.Query("w"))
+		height, herr := strconv.Atoi(ctx.Query("h"))
+		if werr != nil || herr != nil || !conf.ImageSizeAllowed(width, height) {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				"size not allowed",
+			).Send(ctx)
+
+			return
+		}
+
+		fit := ctx.DefaultQuery("fit", "contain")
+		if fit != "contain" && fit != "cover" {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				"fit must be contain or cover",
+			).Send(ctx)
+
+			return
+		}
+
+		file, err := pg.QueryVisibleFile(username, ctx.Param("fileId"))
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrFileNotFound,
+				"file not found",
+			).Send(ctx)
+
+			return
+		}
+
+		if !file.IsImage() {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidFile,
+				"not an image",
+			).Send(ctx)
+
+			return
+		}
+
+		format := ctx.Query("fmt")
+		if len(format) == 0 {
+			ctx.Header("Vary", "Accept")
+			format = utils.PreferredImageFormat(ctx.GetHeader("Accept"), conf.ImageFormats())
+		}
+		if len(format) == 0 {
+			// pngs keep their transparency
+			format = "jpeg"
+			if file.MimeType == "image/png" {
+				format = "png"
+			}
+		}
+
+		if format != "jpeg" && format != "png" && !(models.IsAlternateFormat(format) && slices.Contains(conf.ImageFormats(), format)) {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				"unsupported format",
+			).Send(ctx)
+
+			return
+		}
+
+		edits, err := pg.GetFileEdits(file.ID)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get edits",
+			).Send(ctx)
+
+			return
+		}
+
+		// hash and edit version make variants of the same content shared and never stale
+		key := fmt.Sprintf("%s_v%d_%dx%d_%s%s", file.Hash, edits.Version, width, height, fit, media.Extensions[format])
+
+		f, err := imgCache.Open(key, func(w io.Writer) error {
+			src, err := media.DecodeImage(file.FilePath, file.MimeType)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %v", file.FilePath, err)
+			}
+			src = media.ApplyEdits(src, edits.Ops)
+
+			if fit == "cover" {
+				return media.Encode(w, imaging.Fill(src, width, height, imaging.Center, imaging.Lanczos), format)
+			}
+
+			return media.Encode(w, imaging.Fit(src, width, height, imaging.Lanczos), format)
+		})
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrInvalidFile,
+				"failed to render image",
+			).Send(ctx)
+
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+
+		ctx.Header("ETag", fmt.Sprintf(`"%s"`, key))
+		ctx.Header("Cache-Control", utils.REVALIDATE_CACHE_CONTROL)
+		http.ServeContent(ctx.Writer, ctx.Request, key, info.ModTime(), f)
+	}
+}
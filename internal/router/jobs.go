@@ -0,0 +1,121 @@
+package router
+
+import (
+	"fmt"
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func toJobResponse(job models.Job) models.JobResponse {
+	resp := models.JobResponse{Job: job}
+	if job.Status == models.JobDone && len(job.FilePath) > 0 {
+		resp.DownloadURL = fmt.Sprintf("/jobs/%d/download", job.ID)
+	}
+
+	return resp
+}
+
+func getJob(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		job, err := pg.QueryJob(username, ctx.Param("jobId"))
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrRecordNotFound,
+				"job not found",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(toJobResponse(job)).Send(ctx)
+	}
+}
+
+func downloadJob(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		job, err := pg.QueryJob(username, ctx.Param("jobId"))
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrRecordNotFound,
+				"job not found",
+			).Send(ctx)
+
+			return
+		}
+
+		if job.Status != models.JobDone || len(job.FilePath) == 0 {
+			models.ErrorResponse(
+				http.StatusConflict,
+				models.ErrInvalidInput,
+				"job is not finished",
+			).Send(ctx)
+
+			return
+		}
+
+		if job.ExpiresAt != nil && job.ExpiresAt.Before(time.Now()) {
+			models.ErrorResponse(
+				http.StatusGone,
+				models.ErrFileNotFound,
+				"download expired",
+			).Send(ctx)
+
+			return
+		}
+
+		filename := fmt.Sprintf("kmem-%s-%d%s", job.Kind, job.ID, filepath.Ext(job.FilePath))
+		ctx.FileAttachment(job.FilePath, filename)
+	}
+}
@@ -0,0 +1,268 @@
+package router
+
+import (
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/events"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// galleries of everyone seeing the album show its files
+func invalidateAlbumAudience(pg *db.Postgres, cache *cache.Cache, albumId string) {
+	audience, err := pg.GetAlbumAudience(albumId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, name := range audience {
+		cache.InvalidateUserGallery(name)
+	}
+}
+
+// the owner of the file and members of albums holding it see the change
+func notifyFileAudience(pg *db.Postgres, cache *cache.Cache, bus *events.Bus, fileId int, kind models.EventKind, data any) {
+	audience, err := pg.GetFileAudience(fileId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, name := range audience {
+		cache.InvalidateUserGallery(name)
+		bus.Publish(name, kind, data)
+	}
+}
+
+func getAlbumMembers(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		album, err := pg.GetAlbum(username, ctx.Param("albumId"))
+		if err != nil {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrRecordNotFound,
+				"album not found",
+			).Send(ctx)
+
+			return
+		}
+
+		members, err := pg.GetAlbumMembers(ctx.Param("albumId"))
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get album members",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(struct {
+			Owner   string               `json:"owner"`
+			Members []models.AlbumMember `json:"members"`
+		}{album.Username, members}).Send(ctx)
+	}
+}
+
+// invites a user or changes their role, owner only
+func setAlbumMember(pg *db.Postgres, cache *cache.Cache, ctx *gin.Context, owner string, req models.MemberRequest) {
+	if !models.IsMemberRole(req.Role) {
+		models.ErrorResponse(
+			http.StatusBadRequest,
+			models.ErrValidation,
+			"role must be viewer, contributor or editor",
+		).Send(ctx)
+
+		return
+	}
+
+	if _, err := pg.QueryUser(req.Username); err != nil {
+		models.ErrorResponse(
+			http.StatusNotFound,
+			models.ErrRecordNotFound,
+			"user not found",
+		).Send(ctx)
+
+		return
+	}
+
+	ok, err := pg.SetAlbumMember(owner, ctx.Param("albumId"), req.Username, req.Role)
+	if err != nil {
+		log.Println(err)
+
+		models.ErrorResponse(
+			http.StatusInternalServerError,
+			models.ErrDatabase,
+			"failed to set album member",
+		).Send(ctx)
+
+		return
+	}
+
+	if !ok {
+		models.ErrorResponse(
+			http.StatusForbidden,
+			models.ErrForbidden,
+			"only the owner can share the album",
+		).Send(ctx)
+
+		return
+	}
+
+	cache.InvalidateUserGallery(req.Username)
+
+	models.SuccessResponse(nil).Send(ctx)
+}
+
+func addAlbumMember(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.MemberRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || len(req.Username) == 0 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"username and role required",
+			).Send(ctx)
+
+			return
+		}
+
+		setAlbumMember(pg, cache, ctx, username, req)
+	}
+}
+
+func updateAlbumMember(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.MemberRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"role required",
+			).Send(ctx)
+
+			return
+		}
+		req.Username = ctx.Param("username")
+
+		setAlbumMember(pg, cache, ctx, username, req)
+	}
+}
+
+// the owner removes a member, members leave by removing themselves
+func removeAlbumMember(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		member := ctx.Param("username")
+		if err := pg.RemoveAlbumMember(username, ctx.Param("albumId"), member); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to remove album member",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(member)
+
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/memories"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// built by the daily job, or here when the cache lost them
+func getMemories(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		today := time.Now()
+		cacheKey := memories.CacheKey(username, today)
+
+		if v, ok := cache.Get(cacheKey); ok {
+			models.SuccessResponse(v).Send(ctx)
+			return
+		}
+
+		resp, err := memories.Build(pg, username, today)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get memories",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.SetFor(cacheKey, resp, utils.MEMORIES_CACHE_DUR)
+		models.SuccessResponse(resp).Send(ctx)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"kmem/internal/cache"
 	"kmem/internal/config"
 	"kmem/internal/db"
+	"kmem/internal/diskcache"
+	"kmem/internal/events"
+	"kmem/internal/geo"
 	"kmem/internal/queue"
 	"net/http"
 	"time"
@@ -12,7 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func Setup(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache) *gin.Engine {
+func Setup(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus, imgCache *diskcache.Cache, geocoder *geo.Geocoder) *gin.Engine {
 	router := gin.Default()
 
 	router.Use(cors.New(cors.Config{
@@ -25,11 +28,24 @@ func Setup(pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Ca
 	}))
 
 	router.GET("ping", ping) // for test & health check
-	router.StaticFS("static", http.Dir(conf.UploadPath()))
+	router.GET("static/*filepath", serveStatic(pg, conf))
+	router.HEAD("static/*filepath", serveStatic(pg, conf))
 
 	setupAuth(router, pg, conf)
-	setupFiles(router, pg, conf, q, cache)
+	setupFiles(router, pg, conf, q, cache, bus, geocoder)
 	setupStats(router, pg, conf, cache)
+	setupAlbums(router, pg, conf, cache)
+	setupFolders(router, pg, conf)
+	setupJobs(router, pg, conf)
+	setupTags(router, pg, conf)
+	setupExport(router, pg, conf, q, bus)
+	setupAdmin(router, pg, conf, q, cache, bus, geocoder)
+	setupSync(router, pg, conf)
+	setupEvents(router, conf, bus)
+	setupImg(router, pg, conf, imgCache)
+	setupDuplicates(router, pg, conf, q, cache, bus)
+	setupStacks(router, pg, conf, q, cache)
+	setupMemories(router, pg, conf, cache)
 
 	return router
 }
@@ -48,14 +64,25 @@ func setupAuth(router *gin.Engine, pg *db.Postgres, conf *config.Config) {
 	}
 }
 
-func setupFiles(router *gin.Engine, pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache) {
+func setupFiles(router *gin.Engine, pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus, geocoder *geo.Geocoder) {
 	gr := router.Group("files")
 	gr.Use(authMiddleware(conf))
 	{
 		gr.GET("", servFiles(pg, cache))
-		gr.POST("upload", upload(pg, conf, q, cache))
-		gr.DELETE(":fileId", deleteFile(pg, cache))
-		gr.PUT(":fileId", renameFile(pg, cache))
+		gr.GET("geo", getGeoClusters(pg))
+		gr.POST("upload", upload(pg, conf, q, cache, bus, geocoder))
+		gr.POST("check", checkFiles(pg))
+		gr.GET("download", downloadFiles(pg, conf, q, bus))
+		gr.POST("download", downloadFiles(pg, conf, q, bus))
+		gr.DELETE(":fileId", deleteFile(pg, cache, bus))
+		gr.PUT(":fileId", renameFile(pg, cache, bus))
+		gr.PUT(":fileId/caption", updateCaption(pg, cache))
+		gr.PUT(":fileId/tags", setFileTags(pg, cache))
+		gr.GET(":fileId/edits", getFileEdits(pg))
+		gr.POST(":fileId/edits", addFileEdit(pg, conf, q, cache, bus))
+		gr.PUT(":fileId/edits", replaceFileEdits(pg, conf, q, cache, bus))
+		gr.DELETE(":fileId/edits", replaceFileEdits(pg, conf, q, cache, bus))
+		gr.GET(":fileId/edited", exportEdited(pg))
 	}
 }
 
@@ -66,3 +93,125 @@ func setupStats(router *gin.Engine, pg *db.Postgres, conf *config.Config, cache
 		gr.GET("usage", getUsage(pg, cache))
 	}
 }
+
+func setupAlbums(router *gin.Engine, pg *db.Postgres, conf *config.Config, cache *cache.Cache) {
+	gr := router.Group("albums")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET("", getAlbums(pg))
+		gr.POST("", createAlbum(pg))
+		gr.PUT(":albumId", renameAlbum(pg))
+		gr.PUT(":albumId/query", updateAlbumQuery(pg))
+		gr.DELETE(":albumId", deleteAlbum(pg, cache))
+		gr.GET(":albumId/files", getAlbumFiles(pg))
+		gr.POST(":albumId/files", addAlbumFiles(pg, cache))
+		gr.DELETE(":albumId/files/:fileId", removeAlbumFile(pg, cache))
+		gr.GET(":albumId/members", getAlbumMembers(pg))
+		gr.POST(":albumId/members", addAlbumMember(pg, cache))
+		gr.PUT(":albumId/members/:username", updateAlbumMember(pg, cache))
+		gr.DELETE(":albumId/members/:username", removeAlbumMember(pg, cache))
+	}
+}
+
+func setupFolders(router *gin.Engine, pg *db.Postgres, conf *config.Config) {
+	gr := router.Group("folders")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET("", getFolder(pg))
+		gr.POST("", createFolder(pg))
+		gr.POST("move", moveFiles(pg))
+		gr.GET(":folderId", getFolder(pg))
+		gr.PUT(":folderId", renameFolder(pg))
+		gr.PUT(":folderId/parent", moveFolder(pg))
+		gr.DELETE(":folderId", deleteFolder(pg))
+	}
+}
+
+func setupJobs(router *gin.Engine, pg *db.Postgres, conf *config.Config) {
+	gr := router.Group("jobs")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET(":jobId", getJob(pg))
+		gr.GET(":jobId/download", downloadJob(pg))
+	}
+}
+
+func setupTags(router *gin.Engine, pg *db.Postgres, conf *config.Config) {
+	gr := router.Group("tags")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET("", getTags(pg))
+	}
+}
+
+func setupExport(router *gin.Engine, pg *db.Postgres, conf *config.Config, q *queue.Queue, bus *events.Bus) {
+	gr := router.Group("export")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.POST("", exportAccount(pg, conf, q, bus))
+	}
+}
+
+func setupAdmin(router *gin.Engine, pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus, geocoder *geo.Geocoder) {
+	gr := router.Group("admin")
+	gr.Use(authMiddleware(conf), adminMiddleware(conf))
+	{
+		gr.POST("import", importFiles(pg, conf, q, cache, bus, geocoder))
+	}
+}
+
+func setupSync(router *gin.Engine, pg *db.Postgres, conf *config.Config) {
+	gr := router.Group("sync")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET("", syncChanges(pg))
+	}
+}
+
+func setupEvents(router *gin.Engine, conf *config.Config, bus *events.Bus) {
+	gr := router.Group("events")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET("", streamEvents(bus))
+	}
+}
+
+func setupImg(router *gin.Engine, pg *db.Postgres, conf *config.Config, imgCache *diskcache.Cache) {
+	gr := router.Group("img")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET(":fileId", renderImage(pg, conf, imgCache))
+	}
+}
+
+func setupDuplicates(router *gin.Engine, pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache, bus *events.Bus) {
+	gr := router.Group("duplicates")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET("", getDuplicates(pg))
+		gr.POST("scan", scanDuplicates(pg, q, bus))
+		gr.POST("trash", trashDuplicates(pg, cache, bus))
+	}
+}
+
+func setupStacks(router *gin.Engine, pg *db.Postgres, conf *config.Config, q *queue.Queue, cache *cache.Cache) {
+	gr := router.Group("stacks")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.POST("", createStack(pg, cache))
+		gr.POST("detect", detectStacks(pg, q, cache))
+		gr.PUT(":stackId", setStackPrimary(pg, cache))
+		gr.DELETE(":stackId", deleteStack(pg, cache))
+		gr.GET(":stackId/files", getStackFiles(pg))
+		gr.POST(":stackId/files", addStackFiles(pg, cache))
+		gr.DELETE(":stackId/files/:fileId", removeStackFile(pg, cache))
+	}
+}
+
+func setupMemories(router *gin.Engine, pg *db.Postgres, conf *config.Config, cache *cache.Cache) {
+	gr := router.Group("memories")
+	gr.Use(authMiddleware(conf))
+	{
+		gr.GET("", getMemories(pg, cache))
+	}
+}
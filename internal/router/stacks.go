@@ -0,0 +1,364 @@
+package router
+
+import (
+	"kmem/internal/cache"
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/queue"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// members of a stack, primary first
+func getStackFiles(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		files, err := pg.GetStackFiles(username, ctx.Param("stackId"))
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to get stack files",
+			).Send(ctx)
+
+			return
+		}
+
+		if len(files) == 0 {
+			models.ErrorResponse(
+				http.StatusNotFound,
+				models.ErrRecordNotFound,
+				"stack not found",
+			).Send(ctx)
+
+			return
+		}
+
+		models.SuccessResponse(files).Send(ctx)
+	}
+}
+
+// stacks files by hand, files already in a stack are moved over
+func createStack(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req models.StackRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || len(req.FileIDs) == 0 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"file ids required",
+			).Send(ctx)
+
+			return
+		}
+
+		if req.Primary == 0 {
+			req.Primary = req.FileIDs[0]
+		}
+
+		ids := slices.Clone(req.FileIDs)
+		if !slices.Contains(ids, req.Primary) {
+			ids = append(ids, req.Primary)
+		}
+		slices.Sort(ids)
+		if len(slices.Compact(ids)) < 2 {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrValidation,
+				"a stack needs at least two files",
+			).Send(ctx)
+
+			return
+		}
+
+		stackId, err := pg.CreateStack(username, models.StackManual, req.Primary, req.FileIDs)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to create stack",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(map[string]any{"id": stackId}).Send(ctx)
+	}
+}
+
+// the file shown for the stack in the gallery
+func setStackPrimary(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			Primary int `json:"primary" binding:"required"`
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"primary required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.SetStackPrimary(username, ctx.Param("stackId"), req.Primary); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to set stack primary",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+func addStackFiles(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		var req struct {
+			FileIDs []int `json:"fileIds" binding:"required"`
+		}
+
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			models.ErrorResponse(
+				http.StatusBadRequest,
+				models.ErrInvalidInput,
+				"file ids required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.AddStackFiles(username, ctx.Param("stackId"), req.FileIDs); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to add files to stack",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+// the file shows up on its own again, the stack goes away when one file is left
+func removeStackFile(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.RemoveStackFile(username, ctx.Param("stackId"), ctx.Param("fileId")); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to remove file from stack",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+// unstacks, the files themselves are kept
+func deleteStack(pg *db.Postgres, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		if err := pg.DeleteStack(username, ctx.Param("stackId")); err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to delete stack",
+			).Send(ctx)
+
+			return
+		}
+
+		cache.InvalidateUserGallery(username)
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
+
+// auto stacks live photos and bursts among files uploaded before
+func detectStacks(pg *db.Postgres, q *queue.Queue, cache *cache.Cache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		q.Add(queue.DetectStacks(pg, cache, username))
+		models.SuccessResponse(nil).Send(ctx)
+	}
+}
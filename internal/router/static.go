@@ -0,0 +1,148 @@
+package router
+
+import (
+	"kmem/internal/config"
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// types go's mime table doesn't know everywhere
+var staticTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// finds what a /static path belongs to from the upload layout
+//
+//	<user>/<stored name>                                   original
+//	<user>/thumbnails/<size>/<stored name>[.v<n>][.jpg]    thumbnail
+//	<user>/renditions/<stored name>[.v<n>]/...             hls rendition
+//
+// .v<n> is the edit version of edited files
+func lookupStatic(pg *db.Postgres, rel string) (models.StaticEntry, bool) {
+	parts := strings.Split(strings.TrimPrefix(rel, "/"), "/")
+
+	if len(parts) > 3 && parts[1] == "renditions" {
+		e, err := pg.GetStaticEntryByStoredName(parts[0], trimEditVersion(parts[2]), strings.Join(parts[3:], "/"))
+		return e, err == nil
+	}
+
+	e, err := pg.GetStaticEntry("/static" + rel)
+	return e, err == nil
+}
+
+// <stored name>.v3 -> <stored name>
+func trimEditVersion(name string) string {
+	i := strings.LastIndex(name, ".v")
+	if i < 0 {
+		return name
+	}
+
+	if _, err := strconv.Atoi(name[i+2:]); err != nil {
+		return name
+	}
+
+	return name[:i]
+}
+
+// serves uploads with range requests, etags and conditional requests
+// (all handled by http.ServeContent), ?download=1 forces a save dialog
+func serveStatic(pg *db.Postgres, conf *config.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rel := path.Clean("/" + ctx.Param("filepath"))
+		abs := filepath.Join(conf.UploadPath(), filepath.FromSlash(rel))
+
+		f, err := os.Open(abs)
+		if err != nil {
+			ctx.Status(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			ctx.Status(http.StatusNotFound)
+			return
+		}
+
+		e, ok := lookupStatic(pg, rel)
+
+		// thumbnail fallbacks are swapped for a smaller format the client takes
+		if ok && len(e.Variant) > 0 && len(e.Format) > 0 && !models.IsAlternateFormat(e.Format) {
+			ctx.Header("Vary", "Accept")
+
+			if format := utils.PreferredImageFormat(ctx.GetHeader("Accept"), conf.ImageFormats()); len(format) > 0 {
+				if alt, af, ai, err := openAlternate(pg, e, format); err == nil {
+					defer af.Close()
+					f, info, e.Format = af, ai, alt.Format
+				}
+			}
+		}
+
+		name := info.Name()
+
+		switch {
+		case !ok:
+			// unknown to the db, only modtime based revalidation
+			ctx.Header("Cache-Control", utils.REVALIDATE_CACHE_CONTROL)
+		case len(e.Variant) == 0:
+			// originals can be trashed or purged, always revalidate
+			ctx.Header("ETag", e.ETag())
+			ctx.Header("Cache-Control", utils.REVALIDATE_CACHE_CONTROL)
+			name = e.OriginalName
+		default:
+			// derivative paths are unique per upload and never rewritten
+			ctx.Header("ETag", e.ETag())
+			ctx.Header("Cache-Control", utils.IMMUTABLE_CACHE_CONTROL)
+		}
+
+		ctx.Header("X-Content-Type-Options", "nosniff")
+
+		t, known := staticTypes[strings.ToLower(filepath.Ext(abs))]
+		if known {
+			ctx.Header("Content-Type", t)
+		}
+
+		// general files (html, svg, scripts...) would run on this origin if
+		// shown inline, only media and our own derivatives are
+		if _, err := utils.GetAllowedMimeType(abs); err != nil && !known && (!ok || len(e.Variant) == 0) {
+			ctx.Header("Content-Type", "application/octet-stream")
+			ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		} else if ctx.Query("download") == "1" {
+			ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		}
+
+		// content type is guessed from the name on disk, the original name may lie
+		http.ServeContent(ctx.Writer, ctx.Request, info.Name(), info.ModTime(), f)
+	}
+}
+
+func openAlternate(pg *db.Postgres, e models.StaticEntry, format string) (models.Thumbnail, *os.File, os.FileInfo, error) {
+	t, err := pg.QueryThumbnailFormat(e.FileID, e.Variant, format)
+	if err != nil {
+		return t, nil, nil, err
+	}
+
+	f, err := os.Open(t.FilePath)
+	if err != nil {
+		return t, nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return t, nil, nil, err
+	}
+
+	return t, f, info, nil
+}
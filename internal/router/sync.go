@@ -0,0 +1,133 @@
+package router
+
+import (
+	"kmem/internal/db"
+	"kmem/internal/models"
+	"kmem/internal/utils"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func syncChanges(pg *db.Postgres) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		v, ok := ctx.Get(utils.USERNAME_KEY)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		username, ok := v.(string)
+		if !ok {
+			models.ErrorResponse(
+				http.StatusUnauthorized,
+				models.ErrUnauthorized,
+				"authentication required",
+			).Send(ctx)
+
+			return
+		}
+
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > utils.MAX_SYNC_LIMIT {
+			limit = utils.MAX_SYNC_LIMIT
+		}
+
+		compacted, err := pg.GetCompactedChangeId()
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to sync",
+			).Send(ctx)
+
+			return
+		}
+
+		latest, err := pg.GetLatestChangeId()
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to sync",
+			).Send(ctx)
+
+			return
+		}
+
+		// no token, a broken one, one older than the log or one never handed
+		// out (a restored db, another server): start over
+		since, err := strconv.ParseInt(ctx.Query("since"), 10, 64)
+		if err != nil || since < 0 || since < compacted || since > latest {
+			models.SuccessResponse(models.SyncResponse{
+				Changes: []models.Change{},
+				Files:   []models.FileResponse{},
+				Token:   strconv.FormatInt(latest, 10),
+				Resync:  true,
+			}).Send(ctx)
+
+			return
+		}
+
+		changes, err := pg.GetChangesSince(username, since, limit)
+		if err != nil {
+			log.Println(err)
+
+			models.ErrorResponse(
+				http.StatusInternalServerError,
+				models.ErrDatabase,
+				"failed to sync",
+			).Send(ctx)
+
+			return
+		}
+
+		seen := make(map[int]bool)
+		fileIds := []int{}
+		for _, c := range changes {
+			if c.FileID != 0 && !seen[c.FileID] {
+				seen[c.FileID] = true
+				fileIds = append(fileIds, c.FileID)
+			}
+		}
+
+		files := []models.FileResponse{}
+		if len(fileIds) > 0 {
+			files, err = pg.GetFileResponsesByIds(username, fileIds)
+			if err != nil {
+				log.Println(err)
+
+				models.ErrorResponse(
+					http.StatusInternalServerError,
+					models.ErrDatabase,
+					"failed to sync",
+				).Send(ctx)
+
+				return
+			}
+		}
+
+		token := since
+		if len(changes) > 0 {
+			token = changes[len(changes)-1].ID
+		}
+
+		models.SuccessResponse(models.SyncResponse{
+			Changes: changes,
+			Files:   files,
+			Token:   strconv.FormatInt(token, 10),
+			HasMore: len(changes) == limit,
+		}).Send(ctx)
+	}
+}
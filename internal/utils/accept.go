@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// whether an Accept header allows mimeType, wildcards don't count since
+// browsers send */* even for formats they can't decode
+func Accepts(accept, mimeType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), mimeType) {
+			continue
+		}
+
+		for _, p := range params[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && k == "q" {
+				if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// best of formats (webp, avif) the client takes, avif wins, empty if none
+func PreferredImageFormat(accept string, formats []string) string {
+	// smallest first
+	for _, format := range []string{"avif", "webp"} {
+		for _, f := range formats {
+			if f == format && Accepts(accept, "image/"+format) {
+				return format
+			}
+		}
+	}
+
+	return ""
+}
@@ -14,6 +14,76 @@ const (
 
 // gin context
 const (
-	USERNAME_KEY  = "username"
-	DEAFULT_LIMIT = 20
+	USERNAME_KEY   = "username"
+	DEAFULT_LIMIT  = 20
+	MAX_HASH_CHECK = 1000 // hashes per /files/check request
+	MAX_SYNC_LIMIT = 1000 // changes per /sync page
+	MAX_EDIT_OPS   = 50   // steps in an edit stack, every render replays all of them
+)
+
+// video previews
+const (
+	PREVIEW_CLIPS    = 4   // points sampled for the looping preview
+	PREVIEW_CLIP_DUR = 1.5 // seconds per point
+	SPRITE_COLUMNS   = 5
+	SPRITE_ROWS      = 5
+	SPRITE_TILE_W    = 160
+	SPRITE_TILE_H    = 90
+)
+
+// static
+const (
+	IMMUTABLE_CACHE_CONTROL  = "public, max-age=31536000, immutable"
+	REVALIDATE_CACHE_CONTROL = "no-cache"
+)
+
+// jobs
+const (
+	JOB_RESULT_DUR    = 24 * time.Hour // archives can be downloaded for a day
+	EXPORT_RESULT_DUR = 7 * 24 * time.Hour
+	IMPORT_FEED_SIZE  = 64             // imported files waiting for their thumbnail & metadata items
+	IMPORT_TMP_PREFIX = ".import-"     // files being hashed, renamed into place once checked
+	IMPORT_TMP_DUR    = 24 * time.Hour // untouched that long, the import died
+)
+
+// events
+const (
+	SSE_KEEPALIVE_DUR = 30 * time.Second // keeps proxies from closing idle streams
+	QUOTA_WARN_RATIO  = 0.9
+)
+
+// sync
+const (
+	CHANGE_RETENTION_DUR = 90 * 24 * time.Hour // older entries are compacted, clients then resync
+)
+
+// duplicates, hamming distances of 64 bit perceptual hashes
+const (
+	DUPLICATE_DISTANCE     = 10 // default, catches resaves and light crops
+	MAX_DUPLICATE_DISTANCE = 20 // beyond that unrelated photos start to match
+	MAX_TRASH_BATCH        = 1000
+)
+
+// stacks
+const (
+	LIVE_PHOTO_WINDOW = 3 * time.Second // still and clip of a live photo are stamped this close
+	BURST_GAP         = 2 * time.Second // max time between two shots of a burst
+	BURST_MIN_SHOTS   = 3               // fewer look like two quick snaps, not a burst
+	STACK_SEARCH_SPAN = 1 * time.Minute // around a file, longer bursts grow as more files come in
+)
+
+// geo
+const (
+	GEO_MAX_DISTANCE_KM = 50.0 // farther from any city a photo gets no place
+	GEO_GRID_CELLS      = 16   // map clusters per side of the bounding box
+)
+
+// memories
+const (
+	MEMORY_MAX_FILES   = 30                  // shown per memory, spread over all of its files
+	TRIP_GAP           = 36 * time.Hour      // a longer break ends the trip
+	TRIP_MAX_SPAN      = 14 * 24 * time.Hour // longer runs are daily life, not a trip
+	TRIP_MIN_FILES     = 30
+	MAX_TRIPS          = 10
+	MEMORIES_CACHE_DUR = 25 * time.Hour // until the next daily build
 )
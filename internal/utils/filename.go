@@ -4,8 +4,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"math/rand"
+	"mime"
 	"net/url"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
@@ -53,32 +55,106 @@ func ValidateFilename(filename string) error {
 	return nil
 }
 
+// types shown in the gallery, thumbnailed and checked against their content
+var mediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+
+	// converted for display, the original is kept as is
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".dng":  "image/x-adobe-dng",
+	".cr2":  "image/x-canon-cr2",
+	".nef":  "image/x-nikon-nef",
+	".arw":  "image/x-sony-arw",
+
+	".mp4":  "video/mp4",
+	".avi":  "video/avi",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+}
+
+// common documents, the system mime table is often missing in containers
+var documentTypes = map[string]string{
+	".txt":      "text/plain",
+	".log":      "text/plain",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".csv":      "text/csv",
+	".json":     "application/json",
+	".pdf":      "application/pdf",
+	".doc":      "application/msword",
+	".docx":     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":      "application/vnd.ms-excel",
+	".xlsx":     "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":      "application/vnd.ms-powerpoint",
+	".pptx":     "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":      "application/vnd.oasis.opendocument.text",
+	".ods":      "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":      "application/vnd.oasis.opendocument.presentation",
+	".zip":      "application/zip",
+	".7z":       "application/x-7z-compressed",
+	".rar":      "application/vnd.rar",
+	".tar":      "application/x-tar",
+	".gz":       "application/gzip",
+}
+
+func IsMediaType(mimeType string) bool {
+	for _, t := range mediaTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// media types only, used where nothing else makes sense (imports of photo libraries)
 func GetAllowedMimeType(filename string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(filename))
 
-	allowedTypes := map[string]string{
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".png":  "image/png",
-		".gif":  "image/gif",
-		".webp": "image/webp",
-
-		".mp4":  "video/mp4",
-		".avi":  "video/avi",
-		".mov":  "video/quicktime",
-		".mkv":  "video/x-matroska",
-		".webm": "video/webm",
+	mimeType, allowed := mediaTypes[ext]
+	if !allowed {
+		return "", fmt.Errorf("file type not allowed: %s", ext)
 	}
 
-	mimeType, allowed := allowedTypes[ext]
-	if !allowed {
+	return mimeType, nil
+}
+
+// any type but the blocked extensions, unknown ones are stored as octet-stream
+func GetMimeType(filename string, blocked []string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if slices.Contains(blocked, ext) {
 		return "", fmt.Errorf("file type not allowed: %s", ext)
 	}
 
+	if mimeType, ok := mediaTypes[ext]; ok {
+		return mimeType, nil
+	}
+
+	if mimeType, ok := documentTypes[ext]; ok {
+		return mimeType, nil
+	}
+
+	mimeType, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil || len(mimeType) == 0 {
+		return "application/octet-stream", nil
+	}
+
 	return mimeType, nil
 }
 
-func ProcessFilename(encodedFilename string) (originalName, safeName, mimeType string, err error) {
+func ProcessFilename(encodedFilename string, blocked []string) (originalName, safeName, mimeType string, err error) {
 	originalName, err = DecodeFilename(encodedFilename)
 	if err != nil {
 		return "", "", "", fmt.Errorf("decode error: %v", err)
@@ -88,7 +164,7 @@ func ProcessFilename(encodedFilename string) (originalName, safeName, mimeType s
 		return "", "", "", fmt.Errorf("validation error: %v", err)
 	}
 
-	mimeType, err = GetAllowedMimeType(originalName)
+	mimeType, err = GetMimeType(originalName, blocked)
 	if err != nil {
 		return "", "", "", fmt.Errorf("mime type error: %v", err)
 	}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// copies src into dst while hashing - every stored file is keyed by this sha256
+func CopyAndHash(dst io.Writer, src io.Reader) (int64, string, error) {
+	hasher := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(dst, hasher), src)
+	if err != nil {
+		return size, "", err
+	}
+
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
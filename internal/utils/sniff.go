@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// enough for every signature below, ftyp boxes list their brands early
+const sniffLen = 512
+
+var (
+	heicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "hevm", "hevs"}
+	heifBrands = []string{"mif1", "msf1"}
+	// top level atoms old quicktime files start with instead of ftyp
+	qtAtoms = []string{"moov", "mdat", "wide", "free", "skip", "pnot"}
+)
+
+// peeks the first bytes of r, the returned reader still yields all of r
+func PeekHead(r io.Reader) ([]byte, io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	return head, br, nil
+}
+
+// detects the type from magic bytes and checks it against the one claimed by
+// the extension, returns the detected type to store. formats sharing a
+// container (mp4/mov, mkv/webm, heic/heif, tiff based raw) count as a match.
+// general files are taken as claimed, only media is decoded later on
+func DetectMimeType(head []byte, claimed string) (string, error) {
+	if !IsMediaType(claimed) {
+		return claimed, nil
+	}
+
+	detected, family := sniff(head)
+	if len(family) == 0 {
+		return "", fmt.Errorf("unrecognized file content")
+	}
+
+	if !slices.Contains(family, claimed) {
+		if len(detected) == 0 {
+			detected = family[0]
+		}
+		return "", fmt.Errorf("content is %s, not %s", detected, claimed)
+	}
+
+	// container alone can't tell, e.g. dng vs nef. same for mp4 files
+	// holding only audio, most don't use an audio brand
+	if len(detected) == 0 || claimed == "audio/mp4" {
+		return claimed, nil
+	}
+
+	return detected, nil
+}
+
+// detected type if known precisely and every type sharing the signature
+func sniff(head []byte) (string, []string) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8, 0xff}):
+		return "image/jpeg", []string{"image/jpeg"}
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png", []string{"image/png"}
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "image/gif", []string{"image/gif"}
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "image/webp", []string{"image/webp"}
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		return "video/avi", []string{"video/avi"}
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return "audio/wav", []string{"audio/wav"}
+	case bytes.HasPrefix(head, []byte("ID3")):
+		// id3 tags come first, mostly mp3 but flac can have them too
+		return "", []string{"audio/mpeg", "audio/flac"}
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac", []string{"audio/flac"}
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return "audio/ogg", []string{"audio/ogg"}
+	case bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		// ebml doctype sits in the header
+		family := []string{"video/x-matroska", "video/webm"}
+		if bytes.Contains(head, []byte("webm")) {
+			return "video/webm", family
+		}
+		return "video/x-matroska", family
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		if len(head) >= 10 && string(head[8:10]) == "CR" {
+			return "image/x-canon-cr2", []string{"image/x-canon-cr2"}
+		}
+		return "", []string{"image/x-adobe-dng", "image/x-nikon-nef", "image/x-sony-arw"}
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return sniffFtyp(head)
+	case len(head) >= 8 && slices.Contains(qtAtoms, string(head[4:8])):
+		return "video/quicktime", []string{"video/mp4", "video/quicktime"}
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		// mpeg audio frame sync, mp3s without id3 tags
+		return "audio/mpeg", []string{"audio/mpeg"}
+	default:
+		return "", nil
+	}
+}
+
+// iso base media files, the major brand decides
+func sniffFtyp(head []byte) (string, []string) {
+	brand := string(head[8:12])
+
+	switch {
+	case slices.Contains(heicBrands, brand):
+		return "image/heic", []string{"image/heic", "image/heif"}
+	case slices.Contains(heifBrands, brand):
+		return "image/heif", []string{"image/heic", "image/heif"}
+	case brand == "qt  ":
+		return "video/quicktime", []string{"video/mp4", "video/quicktime"}
+	case brand == "avif" || brand == "avis":
+		return "image/avif", []string{"image/avif"}
+	case brand == "M4A " || brand == "M4B ":
+		return "audio/mp4", []string{"audio/mp4"}
+	default:
+		// isom, mp41, mp42, avc1, M4V, 3gp ...
+		return "video/mp4", []string{"video/mp4", "video/quicktime", "audio/mp4"}
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// trims, lowercases and dedupes user given tags
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var normalized []string
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+
+		if len(tag) > 64 {
+			return nil, fmt.Errorf("tag too long (max 64 characters): %s", tag)
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized, nil
+}
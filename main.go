@@ -5,9 +5,14 @@ import (
 	"kmem/internal/cache"
 	"kmem/internal/config"
 	"kmem/internal/db"
+	"kmem/internal/diskcache"
+	"kmem/internal/events"
+	"kmem/internal/geo"
 	"kmem/internal/queue"
 	"kmem/internal/router"
+	"kmem/internal/utils"
 	"log"
+	"os"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -41,10 +46,40 @@ func main() {
 
 	cache := cache.New(ctx)
 
+	var geocoder *geo.Geocoder
+	if path := conf.GeoNamesPath(); len(path) > 0 {
+		// places are optional, nil leaves them empty
+		geocoder, err = geo.Load(path, utils.GEO_MAX_DISTANCE_KM)
+		if err != nil {
+			log.Printf("reverse geocoding disabled: %v", err)
+			geocoder = nil
+		}
+	}
+
+	// kmem import -user <username> <directory|archive>
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:], pg, conf, q, cache, geocoder); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	q.Add(queue.CleanItems(pg, conf, cache))
+	q.Add(queue.BuildMemories(pg, cache))
+	if geocoder != nil {
+		q.Add(queue.PlaceFiles(pg, geocoder))
+	}
 	go cleanPeriod(ctx, q, pg, conf, cache)
 
-	if err := router.Setup(pg, conf, q, cache).Run(conf.ServerPort()); err != nil {
+	bus := events.New()
+
+	imgCache, err := diskcache.New(conf.ImageCachePath(), conf.ImageCacheSize())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := router.Setup(pg, conf, q, cache, bus, imgCache, geocoder).Run(conf.ServerPort()); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -59,6 +94,7 @@ func cleanPeriod(ctx context.Context, q *queue.Queue, pg *db.Postgres, conf *con
 			return
 		case <-ticker.C:
 			q.Add(queue.CleanItems(pg, conf, cache))
+			q.Add(queue.BuildMemories(pg, cache))
 		}
 	}
 }
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"kmem/internal/archive"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamerUnique(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"distinct", []string{"a.jpg", "b.jpg"}, []string{"a.jpg", "b.jpg"}},
+		{"collisions", []string{"a.jpg", "a.jpg", "a.jpg"}, []string{"a.jpg", "a (1).jpg", "a (2).jpg"}},
+		{"case insensitive", []string{"IMG.JPG", "img.jpg"}, []string{"IMG.JPG", "img (1).jpg"}},
+		{"numbered name taken", []string{"a (1).jpg", "a.jpg", "a.jpg"}, []string{"a (1).jpg", "a.jpg", "a (2).jpg"}},
+		{"no extension", []string{"notes", "notes"}, []string{"notes", "notes (1)"}},
+		{"path separators", []string{"../../etc/passwd", `..\..\boot.ini`}, []string{"_.._etc_passwd", `_.._boot.ini`}},
+		{"leading dots", []string{".hidden", "...jpg"}, []string{"hidden", "jpg"}},
+		{"empty", []string{"", ".", ""}, []string{"file", "file (1)", "file (2)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := archive.NewNamer()
+
+			var got []string
+			for _, name := range tt.names {
+				got = append(got, n.Unique(name))
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestArchiveEntries(t *testing.T) {
+	modified := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, format := range []string{"zip", "tar"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := archive.New(format, &buf)
+			assert.Nil(t, err)
+
+			n := archive.NewNamer()
+			assert.Nil(t, w.AddBytes(n.Unique("photo.jpg"), []byte("one"), modified))
+			assert.Nil(t, w.AddBytes(n.Unique("Photo.jpg"), []byte("two"), modified))
+			assert.Nil(t, w.Close())
+
+			names := map[string]string{}
+			if format == "zip" {
+				zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+				assert.Nil(t, err)
+
+				for _, f := range zr.File {
+					r, err := f.Open()
+					assert.Nil(t, err)
+					data, _ := io.ReadAll(r)
+					r.Close()
+
+					names[f.Name] = string(data)
+					assert.True(t, modified.Equal(f.Modified.UTC()))
+				}
+			} else {
+				tr := tar.NewReader(&buf)
+				for {
+					hdr, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					assert.Nil(t, err)
+
+					data, _ := io.ReadAll(tr)
+					names[hdr.Name] = string(data)
+					assert.True(t, modified.Equal(hdr.ModTime))
+				}
+			}
+
+			assert.Equal(t, map[string]string{"photo.jpg": "one", "Photo (1).jpg": "two"}, names)
+		})
+	}
+
+	_, err := archive.New("rar", io.Discard)
+	assert.NotNil(t, err)
+}
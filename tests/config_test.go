@@ -7,6 +7,8 @@ import (
 )
 
 func TestConfigLoad(t *testing.T) {
+	requireDB(t)
+
 	assert.NotNil(t, testConfig)
 	assert.Equal(t, ":8000", testConfig.ServerPort())
 }
@@ -7,5 +7,7 @@ import (
 )
 
 func TestPostgresConnection(t *testing.T) {
+	requireDB(t)
+
 	assert.Nil(t, testDB.Ping())
 }
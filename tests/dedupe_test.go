@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"kmem/internal/dedupe"
+	"kmem/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicatePairs(t *testing.T) {
+	files := []models.DuplicateFile{
+		{ID: 1, PHash: 0x0, DHash: 0x0},
+		{ID: 2, PHash: 0x3, DHash: 0x1},         // 2 bits from 1
+		{ID: 3, PHash: 0xff, DHash: 0x0},        // phash 8 bits from 1
+		{ID: 4, PHash: 0x0, DHash: 0xffff},      // dhash too far from everything
+		{ID: 5, PHash: 0xffff0000, DHash: 0x10}, // unrelated
+	}
+
+	tests := []struct {
+		name  string
+		fresh []models.DuplicateFile
+		max   int
+		want  []models.DuplicatePair
+	}{
+		{"nothing fresh", nil, 10, nil},
+		{"one fresh against all", files[1:2], 10, []models.DuplicatePair{
+			{FileA: 1, FileB: 2, Distance: 2},
+			{FileA: 2, FileB: 3, Distance: 6},
+		}},
+		{"fresh pairs once", files[:2], 10, []models.DuplicatePair{
+			{FileA: 1, FileB: 2, Distance: 2},
+			{FileA: 1, FileB: 3, Distance: 8},
+			{FileA: 2, FileB: 3, Distance: 6},
+		}},
+		{"tight distance", files[:1], 2, []models.DuplicatePair{
+			{FileA: 1, FileB: 2, Distance: 2},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, dedupe.Pairs(tt.fresh, files, tt.max))
+		})
+	}
+}
+
+func TestDuplicateGroups(t *testing.T) {
+	early := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	files := []models.DuplicateFile{
+		{ID: 1, Width: 800, Height: 600, UploadedAt: late},
+		{ID: 2, Width: 1600, Height: 1200, UploadedAt: late, PHash: 0x1},
+		{ID: 3, Width: 800, Height: 600, TakenAt: &early, UploadedAt: late},
+		{ID: 4, Width: 800, Height: 600, UploadedAt: late, FileSize: 10},
+		{ID: 5, Width: 800, Height: 600, UploadedAt: late, FileSize: 20},
+		{ID: 6},
+	}
+
+	pairs := []models.DuplicatePair{
+		{FileA: 1, FileB: 2, Distance: 1},
+		{FileA: 2, FileB: 3, Distance: 5}, // 1 and 3 only through 2
+		{FileA: 4, FileB: 5, Distance: 3},
+		{FileA: 5, FileB: 9, Distance: 0}, // 9 trashed, not in files
+		{FileA: 1, FileB: 6, Distance: 15},
+	}
+
+	ids := func(g models.DuplicateGroup) []int {
+		var ids []int
+		for _, f := range g.Files {
+			ids = append(ids, f.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name  string
+		max   int
+		keeps []int
+		ids   [][]int
+	}{
+		// most pixels first, then earliest capture
+		{"transitive", 10, []int{2, 5}, [][]int{{2, 3, 1}, {5, 4}}},
+		{"tight", 3, []int{2, 5}, [][]int{{2, 1}, {5, 4}}},
+		{"loose", 20, []int{2, 5}, [][]int{{2, 3, 1, 6}, {5, 4}}},
+		{"none", 0, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]models.DuplicateFile(nil), files...)
+			groups := dedupe.Group(in, pairs, tt.max)
+
+			var keeps []int
+			var got [][]int
+			for _, g := range groups {
+				keeps = append(keeps, g.Keep)
+				got = append(got, ids(g))
+			}
+
+			assert.Equal(t, tt.keeps, keeps)
+			assert.Equal(t, tt.ids, got)
+		})
+	}
+}
+
+func TestDuplicateGroupDistance(t *testing.T) {
+	files := []models.DuplicateFile{
+		{ID: 1, Width: 10, Height: 10, PHash: 0x7},
+		{ID: 2, Width: 20, Height: 20, PHash: 0x0},
+	}
+
+	groups := dedupe.Group(files, []models.DuplicatePair{{FileA: 1, FileB: 2, Distance: 3}}, 10)
+
+	assert.Len(t, groups, 1)
+	assert.Equal(t, 2, groups[0].Keep)
+	assert.Equal(t, 0, groups[0].Files[0].Distance)
+	assert.Equal(t, 3, groups[0].Files[1].Distance)
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"kmem/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileFilterValidate(t *testing.T) {
+	early := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		filter  models.FileFilter
+		wantErr bool
+	}{
+		{"empty", models.FileFilter{}, false},
+		{"all", models.FileFilter{Type: "all"}, false},
+		{"image", models.FileFilter{Type: "image"}, false},
+		{"video", models.FileFilter{Type: "video"}, false},
+		{"audio", models.FileFilter{Type: "audio"}, false},
+		{"unknown type", models.FileFilter{Type: "document"}, true},
+		{"date range", models.FileFilter{From: &early, To: &late}, false},
+		{"from only", models.FileFilter{From: &late}, false},
+		{"from after to", models.FileFilter{From: &late, To: &early}, true},
+		{"size range", models.FileFilter{MinSize: 10, MaxSize: 20}, false},
+		{"min only", models.FileFilter{MinSize: 10}, false},
+		{"negative size", models.FileFilter{MinSize: -1}, true},
+		{"min above max", models.FileFilter{MinSize: 20, MaxSize: 10}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if tt.wantErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestFileFilterValidateTags(t *testing.T) {
+	f := models.FileFilter{Tags: []string{"  Beach ", "beach", "Sunset"}}
+
+	assert.Nil(t, f.Validate())
+	assert.Equal(t, []string{"beach", "sunset"}, f.Tags)
+
+	long := models.FileFilter{Tags: []string{strings.Repeat("a", 65)}}
+	assert.NotNil(t, long.Validate())
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"kmem/internal/models"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func insertTestFile(t *testing.T, username, name, mimeType string, size int64) int {
+	t.Helper()
+
+	id, err := testDB.InsertFile(models.File{
+		Username:     username,
+		Hash:         username + "-" + name,
+		OriginalName: name,
+		StoredName:   name,
+		FilePath:     "/tmp/" + username + "/" + name,
+		RelativePath: username + "/" + name,
+		FileSize:     size,
+		MimeType:     mimeType,
+	})
+	assert.Nil(t, err)
+
+	return id
+}
+
+// alice sees her own files and bob's shared one, carol's file is private
+func TestGalleryFilters(t *testing.T) {
+	requireDB(t)
+	cleanupTables(t)
+	defer cleanupTables(t)
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		assert.Nil(t, testDB.InsertUser(models.User{Username: name, Password: "testpassword123"}))
+	}
+
+	insertTestFile(t, "alice", "beach.jpg", "image/jpeg", 100)
+	insertTestFile(t, "alice", "city.mp4", "video/mp4", 5000)
+	insertTestFile(t, "alice", "notes.pdf", "application/pdf", 50) // folders only
+	shared := insertTestFile(t, "bob", "beach-bob.jpg", "image/jpeg", 300)
+	insertTestFile(t, "carol", "beach-carol.jpg", "image/jpeg", 300)
+
+	albumId, err := testDB.InsertAlbum(models.Album{Username: "bob", Name: "trip"})
+	assert.Nil(t, err)
+	aid := strconv.Itoa(albumId)
+	assert.Nil(t, testDB.AddAlbumFiles("bob", aid, []int{shared}))
+	ok, err := testDB.SetAlbumMember("bob", aid, "alice", models.RoleViewer)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		filter    models.FileFilter
+		want      int
+		wantOwned int
+	}{
+		{"no filter", models.FileFilter{}, 3, 2},
+		{"all type", models.FileFilter{Type: "all"}, 3, 2},
+		{"type", models.FileFilter{Type: "image"}, 2, 1},
+		{"short search", models.FileFilter{Search: "be"}, 3, 2},
+		{"search", models.FileFilter{Search: "beach"}, 2, 1},
+		{"tags", models.FileFilter{Tags: []string{"a", "b"}}, 0, 0},
+		{"date range", models.FileFilter{From: &from, To: &to}, 3, 2},
+		{"min size", models.FileFilter{MinSize: 200}, 2, 1},
+		{"max size", models.FileFilter{MaxSize: 200}, 1, 1},
+		// an uploader filter keeps the shared files even for smart albums
+		{"shared uploader", models.FileFilter{Uploader: "bob"}, 1, 1},
+		{"own uploader", models.FileFilter{Uploader: "alice"}, 2, 2},
+		{"private uploader", models.FileFilter{Uploader: "carol"}, 0, 0},
+		{"everything", models.FileFilter{
+			Type: "image", Search: "beach", Tags: []string{"x"}, From: &from, To: &to,
+			Camera: "canon", Place: "nice", MinSize: 1, MaxSize: 1 << 20, Uploader: "bob",
+		}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		for _, ownedOnly := range []bool{false, true} {
+			t.Run(tt.name+" owned "+strconv.FormatBool(ownedOnly), func(t *testing.T) {
+				want := tt.want
+				if ownedOnly {
+					want = tt.wantOwned
+				}
+
+				count, err := testDB.GetFilesCount("alice", tt.filter, ownedOnly)
+				assert.Nil(t, err)
+				assert.Equal(t, want, count)
+
+				files, err := testDB.GetFilesPage("alice", 0, 10, "name", tt.filter, ownedOnly)
+				assert.Nil(t, err)
+				assert.Len(t, files, want)
+			})
+		}
+	}
+}
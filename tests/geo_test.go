@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"kmem/internal/geo"
+	"kmem/internal/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a few rows in the geonames dump layout, up to the admin1 column
+func writeGeoNames(t *testing.T, dir string, withNames bool) {
+	t.Helper()
+
+	cities := []string{
+		"2988507\tParis\tParis\t\t48.85341\t2.3488\tP\tPPLC\tFR\t\t11",
+		"5391959\tSan Francisco\tSan Francisco\t\t37.77493\t-122.41942\tP\tPPLA2\tUS\t\tCA",
+		"2198148\tWaiyevo\tWaiyevo\t\t-16.80\t179.98\tP\tPPL\tFJ\t\t03",
+		"# a comment",
+		"broken line",
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cities1000.txt"), []byte(strings.Join(cities, "\n")), 0644))
+
+	if !withNames {
+		return
+	}
+
+	admin1 := "FR.11\tIle-de-France\tIle-de-France\t3012874\nUS.CA\tCalifornia\tCalifornia\t5332921\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "admin1CodesASCII.txt"), []byte(admin1), 0644))
+
+	countries := "#ISO\tISO3\tISO-Numeric\tfips\tCountry\nFR\tFRA\t250\tFR\tFrance\nUS\tUSA\t840\tUS\tUnited States\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "countryInfo.txt"), []byte(countries), 0644))
+}
+
+func TestGeocoderLookup(t *testing.T) {
+	dir := t.TempDir()
+	writeGeoNames(t, dir, true)
+
+	g, err := geo.Load(dir, 50)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     models.Place
+		found    bool
+	}{
+		{"in the city", 48.8566, 2.3522, models.Place{Country: "France", Region: "Ile-de-France", City: "Paris"}, true},
+		{"next cell over", 49.1, 2.4, models.Place{Country: "France", Region: "Ile-de-France", City: "Paris"}, true},
+		{"other continent", 37.8, -122.4, models.Place{Country: "United States", Region: "California", City: "San Francisco"}, true},
+		{"across the antimeridian", -16.8, -179.98, models.Place{Country: "FJ", City: "Waiyevo"}, true},
+		{"too far", 47.0, 2.35, models.Place{}, false},
+		{"open sea", 0, -30, models.Place{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := g.Lookup(tt.lat, tt.lon)
+			assert.Equal(t, tt.found, ok)
+			assert.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestGeocoderCodesAsNames(t *testing.T) {
+	dir := t.TempDir()
+	writeGeoNames(t, dir, false)
+
+	g, err := geo.Load(dir, 50)
+	assert.Nil(t, err)
+
+	p, ok := g.Lookup(37.8, -122.4)
+	assert.True(t, ok)
+	assert.Equal(t, models.Place{Country: "US", City: "San Francisco"}, p)
+}
+
+func TestGeocoderMissing(t *testing.T) {
+	_, err := geo.Load(t.TempDir(), 50)
+	assert.NotNil(t, err)
+
+	// no dataset configured, lookups just find nothing
+	var g *geo.Geocoder
+	p, ok := g.Lookup(48.8566, 2.3522)
+	assert.False(t, ok)
+	assert.Equal(t, models.Place{}, p)
+}
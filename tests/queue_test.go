@@ -13,13 +13,14 @@ import (
 )
 
 func TestQueue(t *testing.T) {
+	requireDB(t)
 
 	q := queue.New(t.Context())
 
 	conf, err := config.Load("../config.yml")
 	assert.Nil(t, err)
 
-	pg, err := db.Connect(conf)
+	pg, err := db.Connect(t.Context(), conf)
 	assert.Nil(t, err)
 	defer pg.Close()
 
@@ -30,7 +31,7 @@ func TestQueue(t *testing.T) {
 		MimeType:   "image/gif",
 	}
 
-	q.Add(queue.GenThumbnail(pg, conf, photo))
+	q.Add(queue.GenThumbnail(pg, conf, nil, photo))
 
 	var wg sync.WaitGroup
 
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"kmem/internal/models"
-	"kmem/internal/router"
 	"kmem/internal/utils"
 	"net/http"
 	"net/http/httptest"
@@ -14,7 +13,7 @@ import (
 )
 
 func TestPing(t *testing.T) {
-	router := router.Setup(testDB, testConfig, testQueue)
+	router := setupRouter(t)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/ping", nil)
@@ -25,9 +24,8 @@ func TestPing(t *testing.T) {
 }
 
 func TestSignupSuccess(t *testing.T) {
+	router := setupRouter(t)
 	cleanupTables(t)
-
-	router := router.Setup(testDB, testConfig, testQueue)
 	testUser := models.User{
 		Username: "testuser",
 		Password: "testpassword123",
@@ -49,10 +47,9 @@ func TestSignupSuccess(t *testing.T) {
 }
 
 func TestSignupValidation(t *testing.T) {
+	router := setupRouter(t)
 	cleanupTables(t)
 
-	router := router.Setup(testDB, testConfig, testQueue)
-
 	tests := []struct {
 		name string
 		user models.User
@@ -77,9 +74,8 @@ func TestSignupValidation(t *testing.T) {
 }
 
 func TestLogin(t *testing.T) {
+	router := setupRouter(t)
 	cleanupTables(t)
-
-	router := router.Setup(testDB, testConfig, testQueue)
 	testUser := models.User{
 		Username: "testuser",
 		Password: "testpassword123",
@@ -107,10 +103,9 @@ func TestLogin(t *testing.T) {
 }
 
 func TestLoginWrongCredentials(t *testing.T) {
+	router := setupRouter(t)
 	cleanupTables(t)
 
-	router := router.Setup(testDB, testConfig, testQueue)
-
 	wrongUser := models.User{
 		Username: "wronguser",
 		Password: "wrongpassword",
@@ -3,12 +3,17 @@ package tests
 import (
 	"context"
 	"fmt"
+	"kmem/internal/cache"
 	"kmem/internal/config"
 	"kmem/internal/db"
+	"kmem/internal/diskcache"
+	"kmem/internal/events"
 	"kmem/internal/queue"
+	"kmem/internal/router"
 	"os"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 )
@@ -17,30 +22,65 @@ var testDB *db.Postgres
 var testConfig *config.Config
 var testQueue *queue.Queue
 
+// why the db tests are skipped, empty when they run
+var noDB string
+
 func TestMain(m *testing.M) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	testQueue = queue.New(ctx)
+
+	// unit tests run anywhere, the rest needs .env, config.yml and postgres
+	if err := connect(ctx); err != nil {
+		noDB = err.Error()
+		fmt.Println("skipping db tests:", noDB)
+	}
+
+	code := m.Run()
+
+	if testDB != nil {
+		testDB.Close()
+	}
+	cancel()
+	os.Exit(code)
+}
+
+func connect(ctx context.Context) error {
 	if err := godotenv.Load("../.env"); err != nil {
-		panic("Failed to load .env file")
+		return fmt.Errorf("failed to load .env file: %v", err)
 	}
 
 	conf, err := config.Load("../config.yml")
 	if err != nil {
-		panic("Failed to load config")
+		return fmt.Errorf("failed to load config: %v", err)
 	}
 	testConfig = conf
 
-	pg, err := db.Connect(conf)
+	pg, err := db.Connect(ctx, conf)
 	if err != nil {
-		fmt.Println(err)
-		panic("Failed to connect to test database")
+		return fmt.Errorf("failed to connect to test database: %v", err)
 	}
 	testDB = pg
 
-	testQueue = queue.New(context.TODO())
+	return nil
+}
 
-	code := m.Run()
+func requireDB(t *testing.T) {
+	t.Helper()
 
-	testDB.Close()
-	os.Exit(code)
+	if len(noDB) > 0 {
+		t.Skip(noDB)
+	}
+}
+
+func setupRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	requireDB(t)
+
+	imgCache, err := diskcache.New(t.TempDir(), 1<<20)
+	assert.Nil(t, err)
+
+	return router.Setup(testDB, testConfig, testQueue, cache.New(t.Context()), events.New(), imgCache, nil)
 }
 
 func cleanupTables(t *testing.T) {
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"kmem/internal/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	tests := []struct {
+		name    string
+		head    []byte
+		claimed string
+		want    string
+		wantErr bool
+	}{
+		{"jpeg", []byte{0xff, 0xd8, 0xff, 0xe0, 0, 0x10, 'J', 'F', 'I', 'F'}, "image/jpeg", "image/jpeg", false},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png", "image/png", false},
+		{"html renamed to jpg", []byte("<!DOCTYPE html><html><script>alert(1)</script>"), "image/jpeg", "", true},
+		{"svg renamed to png", []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)">`), "image/png", "", true},
+		{"jpeg renamed to mp3", []byte{0xff, 0xd8, 0xff, 0xe1}, "audio/mpeg", "", true},
+		{"mp3 frame sync", []byte{0xff, 0xfb, 0x90, 0x64}, "audio/mpeg", "audio/mpeg", false},
+		{"mp3 frame sync renamed to jpg", []byte{0xff, 0xfb, 0x90, 0x64}, "image/jpeg", "", true},
+		{"mp3 with id3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg", "audio/mpeg", false},
+		{"flac with id3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/flac", "audio/flac", false},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "audio/wav", "audio/wav", false},
+		{"webp renamed to wav", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "audio/wav", "", true},
+		{"m4a brand", []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00"), "audio/mp4", "audio/mp4", false},
+		{"m4a with generic brand", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), "audio/mp4", "audio/mp4", false},
+		{"mov named mp4", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), "video/mp4", "video/quicktime", false},
+		{"heic named heif", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heif", "image/heic", false},
+		{"dng container", []byte("II*\x00\x08\x00\x00\x00\x00\x00"), "image/x-adobe-dng", "image/x-adobe-dng", false},
+		{"empty", []byte{}, "image/jpeg", "", true},
+		{"general file as claimed", []byte("<html></html>"), "text/html", "text/html", false},
+		{"pdf as claimed", []byte("%PDF-1.7"), "application/pdf", "application/pdf", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.DetectMimeType(tt.head, tt.claimed)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}